@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+const (
+	defaultBloomCapacity = 100000
+	defaultBloomFPRate   = 0.01
+)
+
+// BloomFilterOptions 布隆过滤器的配置
+type BloomFilterOptions struct {
+	// Capacity 预计保存的 key 数量，默认 100000
+	Capacity int
+	// FPRate 达到 Capacity 时的误判率，默认 0.01
+	FPRate float64
+}
+
+// ParseBloomFilterOptions 未开启 bloom_filter 时返回 nil；
+// 过滤器只记录经过本级的写入及其他节点广播的写入，仅适用于本进程独占的层级（如 ldb），不能用于多个节点共享的层级；
+// 本进程启动前或断线期间由其他节点写入的 key 在再次写入或收到广播前都视为不存在
+func ParseBloomFilterOptions(m map[string]interface{}) *BloomFilterOptions {
+	if !BoolOption(m, "bloom_filter") {
+		return nil
+	}
+	return &BloomFilterOptions{
+		Capacity: IntOption(m, "bloom_filter_capacity"),
+		FPRate:   FloatOption(m, "bloom_filter_fp_rate"),
+	}
+}
+
+// BloomFilter 记录层级中可能存在的 key，MayContain 返回 false 时 key 一定不存在；
+// 删除 key 不会清除对应的位，只会增加误判，需要时通过 Rebuild 重建
+type BloomFilter struct {
+	mu   sync.RWMutex
+	bits []uint64
+	// 重建期间的写入同时记录到 next
+	next []uint64
+	k    uint64
+}
+
+func NewBloomFilter(opts BloomFilterOptions) *BloomFilter {
+	if opts.Capacity <= 0 {
+		opts.Capacity = defaultBloomCapacity
+	}
+	if opts.FPRate <= 0 || opts.FPRate >= 1 {
+		opts.FPRate = defaultBloomFPRate
+	}
+	m := math.Ceil(-float64(opts.Capacity) * math.Log(opts.FPRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(opts.Capacity) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits: make([]uint64, (int(m)+63)/64),
+		k:    uint64(k),
+	}
+}
+
+// locations 按双重哈希计算 key 对应的 k 个位
+func (f *BloomFilter) locations(key string) []uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32|1
+
+	n := uint64(len(f.bits) * 64)
+	locs := make([]uint64, f.k)
+	for i := range locs {
+		locs[i] = (h1 + uint64(i)*h2) % n
+	}
+	return locs
+}
+
+// Add 记录 key，f 为 nil 时忽略
+func (f *BloomFilter) Add(keys ...string) {
+	if f == nil || len(keys) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, key := range keys {
+		for _, loc := range f.locations(key) {
+			f.bits[loc/64] |= 1 << (loc % 64)
+			if f.next != nil {
+				f.next[loc/64] |= 1 << (loc % 64)
+			}
+		}
+	}
+}
+
+// MayContain key 是否可能存在，f 为 nil 时总是返回 true
+func (f *BloomFilter) MayContain(key string) bool {
+	if f == nil {
+		return true
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, loc := range f.locations(key) {
+		if f.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Rebuild 清除已删除 key 留下的位，scan 遍历层级中现有的 key 并逐个传给 add；
+// 重建期间过滤器仍按原有数据判断，新的写入同时记录到重建结果中；scan 失败时保留原有数据，已在重建时直接返回
+func (f *BloomFilter) Rebuild(scan func(add func(key string)) error) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	if f.next != nil {
+		f.mu.Unlock()
+		return nil
+	}
+	f.next = make([]uint64, len(f.bits))
+	f.mu.Unlock()
+
+	err := scan(func(key string) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		for _, loc := range f.locations(key) {
+			f.next[loc/64] |= 1 << (loc % 64)
+		}
+	})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		f.bits = f.next
+	}
+	f.next = nil
+	return err
+}
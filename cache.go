@@ -1,12 +1,14 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
 
 type Cache interface {
 	Getter
+	ContextGetter
 
 	TTL(key string) (time.Duration, bool)
 	Set(key string, value interface{}, expiration ...time.Duration) error
@@ -17,16 +19,65 @@ type Cache interface {
 	IncrBy(key string, step int) (int, error)
 	IncrByFloat(key string, step float64) (float64, error)
 	Del(keys ...string) error
+	MGet(dst map[string]interface{}) (map[string]time.Duration, error)
+	MSet(values map[string]interface{}, expiration ...time.Duration) error
+	MDel(keys ...string) error
+	Evict(keys ...string) error
+	DelPrefix(prefixes ...string) error
+	EvictPrefix(prefixes ...string) error
+	HasGetMeta(key string, dst interface{}) (*Meta, bool)
+	SetIfAbsent(key string, value interface{}, expiration ...time.Duration) (bool, error)
+	SetIfPresent(key string, value interface{}, expiration ...time.Duration) (bool, error)
+	CompareAndSwap(key string, version int64, value interface{}, expiration ...time.Duration) (bool, error)
+	SetAbsent(key string, expiration time.Duration) error
+	IsAbsent(key string) bool
+	SetWithOptions(key string, value interface{}, opts SetOptions) error
 	Close() error
 
+	TTLCtx(ctx context.Context, key string) (time.Duration, bool)
+	SetCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) error
+	HasPrefixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error)
+	HasSuffixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error)
+	ContainsCtx(ctx context.Context, s string, limit ...int) (map[string]string, error)
+	IncrCtx(ctx context.Context, key string) (int, error)
+	IncrByCtx(ctx context.Context, key string, step int) (int, error)
+	IncrByFloatCtx(ctx context.Context, key string, step float64) (float64, error)
+	DelCtx(ctx context.Context, keys ...string) error
+	MGetCtx(ctx context.Context, dst map[string]interface{}) (map[string]time.Duration, error)
+	MSetCtx(ctx context.Context, values map[string]interface{}, expiration ...time.Duration) error
+	MDelCtx(ctx context.Context, keys ...string) error
+	// EvictCtx 仅删除本级的 key，不会传递到下一级，也不会广播给其他节点
+	EvictCtx(ctx context.Context, keys ...string) error
+	// DelPrefixCtx 删除各级中以 prefixes 开头的 key，并广播给其他节点
+	DelPrefixCtx(ctx context.Context, prefixes ...string) error
+	// EvictPrefixCtx 仅删除本级中以 prefixes 开头的 key
+	EvictPrefixCtx(ctx context.Context, prefixes ...string) error
+	HasGetMetaCtx(ctx context.Context, key string, dst interface{}) (*Meta, bool)
+	SetIfAbsentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error)
+	SetIfPresentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error)
+	CompareAndSwapCtx(ctx context.Context, key string, version int64, value interface{}, expiration ...time.Duration) (bool, error)
+	// SetAbsentCtx 写入 key 不存在的标记，标记过期前 Has/HasGet 返回未命中且不再读取下一级
+	SetAbsentCtx(ctx context.Context, key string, expiration time.Duration) error
+	// IsAbsentCtx key 是否带有不存在的标记
+	IsAbsentCtx(ctx context.Context, key string) bool
+	// SetWithOptionsCtx 与 SetCtx 相同，同时记录 opts 中的软过期时间及重新计算的耗时
+	SetWithOptionsCtx(ctx context.Context, key string, value interface{}, opts SetOptions) error
+
+	GetOrLoad(key string, dst interface{}, loader LoaderFunc, ttl time.Duration) error
+	GetOrLoadCtx(ctx context.Context, key string, dst interface{}, loader LoaderFunc, ttl time.Duration) error
+
 	Next() Cache
 	Previous() Cache
 	SetNext(next Cache)
 	SetPrevious(previous Cache)
+	SetPolicy(policy Policy)
 
 	Publish(channel string, message interface{}) error
 	Subscribe(channels []string, handler func(string, string)) error
 	PSubscribe(patterns []string, handler func(string, string)) error
+	PublishCtx(ctx context.Context, channel string, message interface{}) error
+	SubscribeCtx(ctx context.Context, channels []string, handler func(string, string)) error
+	PSubscribeCtx(ctx context.Context, patterns []string, handler func(string, string)) error
 	RemoteSupport() bool
 }
 
@@ -42,12 +93,19 @@ func NewCache(c *Config) (Cache, error) {
 	if !ok {
 		return nil, fmt.Errorf(`cache: unregistered driver: %s`, c.Driver)
 	}
-	return driver.NewCache(c.Options)
+	inst, err := driver.NewCache(c.Options)
+	if err != nil {
+		return nil, err
+	}
+	inst.SetPolicy(c.Policy)
+	return inst, nil
 }
 
 type Config struct {
 	Driver  string
 	Options map[string]interface{}
+	// Policy 本级的读写策略
+	Policy Policy
 }
 
 func NewMultiLevelCache(configs []Config) (Cache, error) {
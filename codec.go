@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"github.com/iamdanielyin/cache/json"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+const (
+	CodecJSON = "json"
+	CodecGob  = "gob"
+	CodecRaw  = "raw"
+)
+
+var ErrUnsupportedValue = errors.New(`cache: value not supported by codec`)
+
+// Codec 值的编码方式，Name 与编码后的数据一同保存，读取时按写入时的编码解码
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(GobCodec{})
+	RegisterCodec(RawCodec{})
+}
+
+// RegisterCodec 注册编码方式，同名的编码方式会被替换
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[codec.Name()] = codec
+}
+
+// GetCodec 按名称查找编码方式，name 为空时返回 JSON
+func GetCodec(name string) (Codec, error) {
+	if name == "" {
+		name = CodecJSON
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf(`cache: unsupported codec: %s`, name)
+	}
+	return codec, nil
+}
+
+// ParseCodec codec 可以是编码方式的名称或 Codec，默认使用 JSON
+func ParseCodec(m map[string]interface{}) (Codec, error) {
+	switch v := m["codec"].(type) {
+	case Codec:
+		return v, nil
+	case string:
+		return GetCodec(v)
+	case nil:
+		return JSONCodec{}, nil
+	}
+	return nil, fmt.Errorf(`cache: unsupported codec: %v`, m["codec"])
+}
+
+// Encoded 已编码的值，写入时原样保存并记录 Codec，不再重新编码
+type Encoded struct {
+	Codec string
+	Data  []byte
+}
+
+// MarshalJSON 使不识别 Encoded 的驱动按 JSON 保存时得到原始的值，仅支持 JSON 编码
+func (e *Encoded) MarshalJSON() ([]byte, error) {
+	if e.Codec != "" && e.Codec != CodecJSON {
+		return nil, fmt.Errorf(`cache: value encoded with %s cannot be marshaled as json`, e.Codec)
+	}
+	return e.Data, nil
+}
+
+// Encode 使用 codec 编码 value，返回实际使用的编码方式名称
+func Encode(codec Codec, value interface{}) (string, []byte, error) {
+	if e, ok := value.(*Encoded); ok {
+		if e.Codec == "" {
+			return CodecJSON, e.Data, nil
+		}
+		return e.Codec, e.Data, nil
+	}
+	data, err := codec.Marshal(value)
+	return codec.Name(), data, err
+}
+
+// Decode 按名称为 name 的编码方式解码，name 为空时视为 JSON
+func Decode(name string, data []byte, dst interface{}) error {
+	codec, err := GetCodec(name)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, dst)
+}
+
+// JSONCodec 默认的编码方式，与 json 包一致
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CodecJSON
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.STD().Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.STD().Unmarshal(data, v)
+}
+
+// GobCodec 使用 encoding/gob 编码，保留 []byte、大整数及时间的精度；接口类型的值需要先通过 gob.Register 注册
+type GobCodec struct{}
+
+func (GobCodec) Name() string {
+	return CodecGob
+}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// RawCodec 原样保存 []byte 及 string，其他类型返回 ErrUnsupportedValue
+type RawCodec struct{}
+
+func (RawCodec) Name() string {
+	return CodecRaw
+}
+
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return append([]byte(nil), v...), nil
+	case string:
+		return []byte(v), nil
+	case *[]byte:
+		return append([]byte(nil), *v...), nil
+	case *string:
+		return []byte(*v), nil
+	}
+	return nil, ErrUnsupportedValue
+}
+
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = append([]byte(nil), data...)
+	case *string:
+		*v = string(data)
+	case *interface{}:
+		*v = append([]byte(nil), data...)
+	default:
+		return ErrUnsupportedValue
+	}
+	return nil
+}
@@ -10,6 +10,8 @@ var (
 	driverMapMu sync.RWMutex
 )
 
+var ErrUnsupportedPubSub = errors.New(`cache: unsupported Publish/Subscribe messages`)
+
 type Driver interface {
 	Name() string
 	NewCache(map[string]interface{}) (Cache, error)
@@ -2,14 +2,15 @@ package ldb
 
 import (
 	"bytes"
-	"fmt"
-	"github.com/buger/jsonparser"
+	"context"
 	"github.com/iamdanielyin/cache"
 	"github.com/iamdanielyin/cache/json"
-	"github.com/pkg/errors"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
-	"os"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"hash/fnv"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -37,612 +38,565 @@ func (l *ldbDriver) NewCache(m map[string]interface{}) (cache.Cache, error) {
 	if v, ok := m["opts"]; ok {
 		_ = json.Copy(v, options)
 	}
-	if fi, err := os.Stat(path); err == nil {
-		if !fi.IsDir() {
-			return nil, fmt.Errorf("leveldb/storage: open %s: not a directory", path)
-		}
-		if err := os.RemoveAll(path); err != nil {
+	eviction, _ := m["eviction"].(string)
+	q, err := newQuota(cache.IntOption(m, "max_entries"), int64(cache.IntOption(m, "max_bytes")), eviction)
+	if err != nil {
+		return nil, err
+	}
+	// persist 为 true 时复用已有数据，skip_format_check 为 true 时跳过格式版本校验
+	persist := cache.BoolOption(m, "persist")
+	db, err := openDB(path, options, persist, !cache.BoolOption(m, "skip_format_check"))
+	if err != nil {
+		return nil, err
+	}
+	if persist {
+		if err := q.load(db); err != nil {
+			_ = db.Close()
 			return nil, err
 		}
 	}
-
-	db, err := leveldb.OpenFile(path, options)
-	if err != nil {
+	inst := &levelDBCache{
+		db:         db,
+		quota:      q,
+		sweepBatch: cache.IntOption(m, "sweep_batch"),
+		stop:       make(chan struct{}),
+	}
+	// bloom_filter 为 true 时一定没有写入过的 key 直接视为未命中，不再读取下一级；复用数据库时按已有的 key 重建
+	if opts := cache.ParseBloomFilterOptions(m); opts != nil {
+		inst.bloom = cache.NewBloomFilter(*opts)
+		if persist {
+			if err := inst.bloom.Rebuild(inst.scanKeys); err != nil {
+				_ = db.Close()
+				return nil, err
+			}
+		}
+	}
+	if inst.Level, err = cache.NewLevel(inst, backend{inst}, m); err != nil {
+		_ = db.Close()
 		return nil, err
 	}
-	return &levelDBCache{db: db}, nil
+	// sweep_interval 大于 0 时在后台定时清理过期的 key
+	if interval := cache.DurationOption(m, "sweep_interval"); interval > 0 {
+		inst.startSweeper(interval)
+	}
+	inst.enforce()
+	return inst, nil
 }
 
-var ErrUnsupportedPubSub = errors.New(`cache: unsupported Publish/Subscribe messages`)
+var ErrUnsupportedPubSub = cache.ErrUnsupportedPubSub
 
 type levelDBCacheValue struct {
 	ExpiredDuration time.Duration `json:"expired_duration"`
 	CreatedAt       time.Time     `json:"created_at"`
+	Version         int64         `json:"version"`
 	Data            []byte        `json:"data"`
+	SoftDuration    time.Duration `json:"soft_duration,omitempty"`
+	Delta           time.Duration `json:"delta,omitempty"`
+	// Absent 为 true 时表示 key 不存在的标记
+	Absent bool `json:"absent,omitempty"`
+	// Codec Data 的编码方式，为空时视为 JSON
+	Codec string `json:"codec,omitempty"`
 }
 
-type levelDBCache struct {
-	db       *leveldb.DB
-	next     cache.Cache
-	previous cache.Cache
+var absentField = []byte(`"absent":true`)
+
+// isAbsent 判断编码后的值是否为不存在的标记，Data 以 base64 编码，不会误判
+func isAbsent(data []byte) bool {
+	return bytes.Contains(data, absentField)
 }
 
-func (l *levelDBCache) Publish(channel string, message interface{}) error {
-	if l.next == nil {
-		return ErrUnsupportedPubSub
-	}
-	return l.next.Publish(channel, message)
+func (v *levelDBCacheValue) expired() bool {
+	return v.ExpiredDuration > 0 && time.Now().After(v.CreatedAt.Add(v.ExpiredDuration))
 }
 
-func (l *levelDBCache) Subscribe(channels []string, handler func(string, string)) error {
-	if l.next == nil {
-		return ErrUnsupportedPubSub
+func (v *levelDBCacheValue) entry() *cache.Entry {
+	return &cache.Entry{
+		Meta: cache.Meta{
+			Version:         v.Version,
+			CreatedAt:       v.CreatedAt,
+			ExpiredDuration: v.ExpiredDuration,
+			SoftDuration:    v.SoftDuration,
+			Delta:           v.Delta,
+		},
+		Data:   v.Data,
+		Codec:  v.Codec,
+		Absent: v.Absent,
 	}
-	return l.next.Subscribe(channels, handler)
 }
 
-func (l *levelDBCache) PSubscribe(patterns []string, handler func(string, string)) error {
-	if l.next == nil {
-		return ErrUnsupportedPubSub
-	}
-	return l.next.PSubscribe(patterns, handler)
+// marshal 按 levelDBCacheValue 的格式编码 e
+func marshal(e *cache.Entry) ([]byte, error) {
+	return json.STD().Marshal(&levelDBCacheValue{
+		ExpiredDuration: e.ExpiredDuration,
+		CreatedAt:       e.CreatedAt,
+		Version:         e.Version,
+		Data:            e.Data,
+		SoftDuration:    e.SoftDuration,
+		Delta:           e.Delta,
+		Absent:          e.Absent,
+		Codec:           e.Codec,
+	})
 }
 
-func (l *levelDBCache) hasGet(path string) (*levelDBCacheValue, bool) {
-	var v levelDBCacheValue
-	data, err := l.db.Get([]byte(path), nil)
-	if err == nil {
-		err = json.STD().Unmarshal(data, &v)
-		if v.ExpiredDuration > 0 {
-			expiredAt := v.CreatedAt.Add(v.ExpiredDuration)
-			if time.Now().After(expiredAt) {
-				err = l.db.Delete([]byte(path), nil)
-				return nil, false
-			}
-		} else {
-			err = l.db.Delete([]byte(path), nil)
-			return nil, false
-		}
-	}
-	return &v, err != leveldb.ErrNotFound
+// backend 在 leveldb 上实现 cache.Backend，并通过布隆过滤器实现 cache.KeyFilter 及 cache.WriteObserver；
+// 未开启布隆过滤器时 MayContain 总是返回 true
+type backend struct {
+	l *levelDBCache
 }
 
-func (l *levelDBCache) TTL(path string) (time.Duration, bool) {
-	v, has := l.hasGet(path)
-	if !has {
-		return 0, has
-	}
-	expiredAt := v.CreatedAt.Add(v.ExpiredDuration)
-	dur := time.Now().Sub(expiredAt)
-	return dur, has
+func (b backend) Get(key string) (*cache.Entry, bool) {
+	return b.l.read(key)
 }
 
-func (l *levelDBCache) Has(path string) bool {
-	_, has := l.hasGet(path)
-	if !has && l.next != nil {
-		has = l.next.Has(path)
+func (b backend) Put(key string, e *cache.Entry) error {
+	data, err := marshal(e)
+	if err != nil {
+		return err
 	}
-	return has
+	unlock := b.l.lockKeys(key)
+	err = b.l.put(key, data)
+	unlock()
+	b.l.enforce()
+	return err
 }
 
-func (l *levelDBCache) HasGet(path string, dst interface{}) bool {
-	cv, has := l.hasGet(path)
-	if has {
-		_ = json.STD().Unmarshal(cv.Data, dst)
-	} else if l.next != nil {
-		has = l.next.HasGet(path, dst)
-		var ttl time.Duration
-		ttl, has = l.next.TTL(path)
-		if has {
-			_ = l.Set(path, dst, ttl)
+func (b backend) PutBatch(entries map[string]*cache.Entry) error {
+	values := make(map[string][]byte, len(entries))
+	for key, e := range entries {
+		data, err := marshal(e)
+		if err != nil {
+			return err
 		}
+		values[key] = data
 	}
-	return has
-}
-
-func (l *levelDBCache) HasGetInt(path string) (int, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseInt(cv.Data)
-		return int(v), has
-	} else if l.next != nil {
-		var v int
-		v, has = l.next.HasGetInt(path)
-		var ttl time.Duration
-		ttl, has = l.next.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return 0, has
+	return b.l.putBatch(values)
 }
 
-func (l *levelDBCache) HasGetInt8(path string) (int8, bool) {
-	v, has := l.HasGetInt(path)
-	return int8(v), has
+func (b backend) Delete(keys ...string) error {
+	return b.l.remove(keys...)
 }
 
-func (l *levelDBCache) HasGetInt16(path string) (int16, bool) {
-	v, has := l.HasGetInt(path)
-	return int16(v), has
+func (b backend) MayContain(key string) bool {
+	return b.l.bloom.MayContain(key)
 }
 
-func (l *levelDBCache) HasGetInt32(path string) (int32, bool) {
-	v, has := l.HasGetInt(path)
-	return int32(v), has
+func (b backend) ObserveWrite(keys ...string) {
+	b.l.bloom.Add(keys...)
 }
 
-func (l *levelDBCache) HasGetInt64(path string) (int64, bool) {
-	v, has := l.HasGetInt(path)
-	return int64(v), has
-}
+const lockStripes = 64
 
-func (l *levelDBCache) HasGetUint(path string) (uint, bool) {
-	v, has := l.HasGetInt(path)
-	return uint(v), has
-}
-
-func (l *levelDBCache) HasGetUint8(path string) (uint8, bool) {
-	v, has := l.HasGetInt(path)
-	return uint8(v), has
-}
-
-func (l *levelDBCache) HasGetUint16(path string) (uint16, bool) {
-	v, has := l.HasGetInt(path)
-	return uint16(v), has
-}
-
-func (l *levelDBCache) HasGetUint32(path string) (uint32, bool) {
-	v, has := l.HasGetInt(path)
-	return uint32(v), has
-}
-
-func (l *levelDBCache) HasGetUint64(path string) (uint64, bool) {
-	v, has := l.HasGetInt(path)
-	return uint64(v), has
-}
-
-func (l *levelDBCache) HasGetFloat(path string) (float64, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseFloat(cv.Data)
-		return v, has
-	} else if l.next != nil {
-		var v float64
-		v, has = l.next.HasGetFloat(path)
-		var ttl time.Duration
-		ttl, has = l.next.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return 0, has
+type levelDBCache struct {
+	// 原子操作的字段需要 64 位对齐，放在首位
+	reclaimed int64
+	*cache.Level
+	db         *leveldb.DB
+	locks      [lockStripes]sync.Mutex
+	quota      *quota
+	sweepBatch int
+	stop       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+	bloom      *cache.BloomFilter
 }
 
-func (l *levelDBCache) HasGetFloat32(path string) (float32, bool) {
-	v, has := l.HasGetFloat(path)
-	return float32(v), has
+func (l *levelDBCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
+	return l.HasPrefixCtx(context.Background(), s, limit...)
 }
 
-func (l *levelDBCache) HasGetFloat64(path string) (float64, bool) {
-	return l.HasGetFloat(path)
-}
+func (l *levelDBCache) HasPrefixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	keyword := []byte(s)
+	v, err := l.filter(ctx, func(key, value []byte) bool {
+		return bytes.HasPrefix(key, keyword)
+	}, limit...)
 
-func (l *levelDBCache) HasGetString(path string) (string, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseString(cv.Data)
-		return v, has
-	} else if l.next != nil {
-		var v string
-		v, has = l.next.HasGetString(path)
-		var ttl time.Duration
-		ttl, has = l.next.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return "", has
-}
-
-func (l *levelDBCache) HasGetBool(path string) (bool, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		v, _ := jsonparser.ParseBoolean(cv.Data)
-		return v, has
-	} else if l.next != nil {
-		var v bool
-		v, has = l.next.HasGetBool(path)
-		var ttl time.Duration
-		ttl, has = l.next.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
-	}
-	return false, has
-}
-
-func (l *levelDBCache) HasGetTime(path string) (time.Time, bool) {
-	cv, has := l.hasGet(path)
-	if has {
-		var v struct{ Data time.Time }
-		_ = json.Parse(fmt.Sprintf(`{"data":"%s"}`, string(cv.Data)), &v)
-		return v.Data, has
-	} else if l.next != nil {
-		var v time.Time
-		v, has = l.next.HasGetTime(path)
-		var ttl time.Duration
-		ttl, has = l.next.TTL(path)
-		if has {
-			_ = l.Set(path, v, ttl)
-		}
-		return v, has
+	if err == nil && len(v) == 0 && l.Next() != nil {
+		return l.Next().HasPrefixCtx(ctx, s, limit...)
 	}
-	return time.Time{}, has
-}
-
-func (l *levelDBCache) Get(path string, dst interface{}) {
-	_ = l.HasGet(path, dst)
-}
 
-func (l *levelDBCache) GetInt(path string) int {
-	v, _ := l.HasGetInt(path)
-	return v
-}
-
-func (l *levelDBCache) GetInt8(path string) int8 {
-	v, _ := l.HasGetInt8(path)
-	return v
+	return v, err
 }
 
-func (l *levelDBCache) GetInt16(path string) int16 {
-	v, _ := l.HasGetInt16(path)
-	return v
+func (l *levelDBCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
+	return l.HasSuffixCtx(context.Background(), s, limit...)
 }
 
-func (l *levelDBCache) GetInt32(path string) int32 {
-	v, _ := l.HasGetInt32(path)
-	return v
-}
+func (l *levelDBCache) HasSuffixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	keyword := []byte(s)
+	v, err := l.filter(ctx, func(key, value []byte) bool {
+		return bytes.HasSuffix(key, keyword)
+	}, limit...)
 
-func (l *levelDBCache) GetInt64(path string) int64 {
-	v, _ := l.HasGetInt64(path)
-	return v
-}
+	if err == nil && len(v) == 0 && l.Next() != nil {
+		return l.Next().HasSuffixCtx(ctx, s, limit...)
+	}
 
-func (l *levelDBCache) GetUint(path string) uint {
-	v, _ := l.HasGetUint(path)
-	return v
+	return v, err
 }
 
-func (l *levelDBCache) GetUint8(path string) uint8 {
-	v, _ := l.HasGetUint8(path)
-	return v
+func (l *levelDBCache) Contains(s string, limit ...int) (map[string]string, error) {
+	return l.ContainsCtx(context.Background(), s, limit...)
 }
 
-func (l *levelDBCache) GetUint16(path string) uint16 {
-	v, _ := l.HasGetUint16(path)
-	return v
-}
+func (l *levelDBCache) ContainsCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	keyword := []byte(s)
+	v, err := l.filter(ctx, func(key, value []byte) bool {
+		return bytes.Contains(key, keyword)
+	}, limit...)
 
-func (l *levelDBCache) GetUint32(path string) uint32 {
-	v, _ := l.HasGetUint32(path)
-	return v
-}
+	if err == nil && len(v) == 0 && l.Next() != nil {
+		return l.Next().ContainsCtx(ctx, s, limit...)
+	}
 
-func (l *levelDBCache) GetUint64(path string) uint64 {
-	v, _ := l.HasGetUint64(path)
-	return v
+	return v, err
 }
 
-func (l *levelDBCache) GetFloat(path string) float64 {
-	v, _ := l.HasGetFloat(path)
-	return v
-}
+func (l *levelDBCache) filter(ctx context.Context, filter func(key, value []byte) bool, limit ...int) (map[string]string, error) {
+	var max int
+	if len(limit) > 0 {
+		max = limit[0]
+	}
 
-func (l *levelDBCache) GetFloat32(path string) float32 {
-	v, _ := l.HasGetFloat32(path)
-	return v
+	var v = make(map[string]string)
+	iter := l.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key := iter.Key()
+		if isReserved(key) {
+			continue
+		}
+		value := iter.Value()
+		if isAbsent(value) {
+			continue
+		}
+		if filter(key, value) {
+			v[string(key)] = string(value)
+		}
+		if max > 0 && len(v) >= max {
+			break
+		}
+	}
+	return v, iter.Error()
 }
 
-func (l *levelDBCache) GetFloat64(path string) float64 {
-	v, _ := l.HasGetFloat64(path)
-	return v
+// read 读取本级保存的值，已过期的值在读取时删除
+func (l *levelDBCache) read(key string) (*cache.Entry, bool) {
+	data, err := l.db.Get([]byte(key), nil)
+	if err != nil {
+		return nil, false
+	}
+	var v levelDBCacheValue
+	if err := json.STD().Unmarshal(data, &v); err != nil {
+		return nil, false
+	}
+	if v.expired() {
+		_ = l.db.Delete([]byte(key), nil)
+		l.quota.remove(key)
+		return nil, false
+	}
+	l.quota.touch(key)
+	return v.entry(), true
 }
 
-func (l *levelDBCache) GetString(path string) string {
-	v, _ := l.HasGetString(path)
-	return v
+// scanKeys 遍历已有的 key，用于重建布隆过滤器
+func (l *levelDBCache) scanKeys(add func(key string)) error {
+	iter := l.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if key := iter.Key(); !isReserved(key) {
+			add(string(key))
+		}
+	}
+	return iter.Error()
 }
 
-func (l *levelDBCache) GetBool(path string) bool {
-	v, _ := l.HasGetBool(path)
-	return v
+func (l *levelDBCache) incr(ctx context.Context, key string, step int) (int, error) {
+	if l.Policy().ReadOnly {
+		return 0, cache.ErrReadOnly
+	}
+	v := l.GetIntCtx(ctx, key)
+	v = v + step
+	err := l.SetCtx(ctx, key, v)
+	return v, err
 }
 
-func (l *levelDBCache) GetTime(path string) time.Time {
-	v, _ := l.HasGetTime(path)
-	return v
+func (l *levelDBCache) Incr(key string) (int, error) {
+	return l.IncrCtx(context.Background(), key)
 }
 
-func (l *levelDBCache) DefaultGet(path string, dst interface{}, defaultValue interface{}) {
-	if !l.HasGet(path, dst) {
-		_ = json.Copy(defaultValue, dst)
+func (l *levelDBCache) IncrCtx(ctx context.Context, key string) (int, error) {
+	if l.Next() != nil {
+		l.bloom.Add(key)
+		if err := l.Flush(ctx, key); err != nil {
+			return 0, err
+		}
+		v, err := l.Next().IncrCtx(ctx, key)
+		if err == nil {
+			_ = l.remove(key)
+		}
+		return v, err
 	}
-}
 
-func (l *levelDBCache) DefaultGetInt(path string, defaultValue int) int {
-	if v, has := l.HasGetInt(path); has {
-		return v
-	}
-	return defaultValue
+	return l.incr(ctx, key, 1)
 }
 
-func (l *levelDBCache) DefaultGetInt8(path string, defaultValue int8) int8 {
-	if v, has := l.HasGetInt8(path); has {
-		return v
-	}
-	return defaultValue
+func (l *levelDBCache) IncrBy(key string, step int) (int, error) {
+	return l.IncrByCtx(context.Background(), key, step)
 }
 
-func (l *levelDBCache) DefaultGetInt16(path string, defaultValue int16) int16 {
-	if v, has := l.HasGetInt16(path); has {
-		return v
+func (l *levelDBCache) IncrByCtx(ctx context.Context, key string, step int) (int, error) {
+	if l.Next() != nil {
+		l.bloom.Add(key)
+		if err := l.Flush(ctx, key); err != nil {
+			return 0, err
+		}
+		v, err := l.Next().IncrByCtx(ctx, key, step)
+		if err == nil {
+			_ = l.remove(key)
+		}
+		return v, err
 	}
-	return defaultValue
-}
 
-func (l *levelDBCache) DefaultGetInt32(path string, defaultValue int32) int32 {
-	if v, has := l.HasGetInt32(path); has {
-		return v
-	}
-	return defaultValue
+	return l.incr(ctx, key, step)
 }
 
-func (l *levelDBCache) DefaultGetInt64(path string, defaultValue int64) int64 {
-	if v, has := l.HasGetInt64(path); has {
-		return v
-	}
-	return defaultValue
+func (l *levelDBCache) IncrByFloat(key string, step float64) (float64, error) {
+	return l.IncrByFloatCtx(context.Background(), key, step)
 }
 
-func (l *levelDBCache) DefaultGetUint(path string, defaultValue uint) uint {
-	if v, has := l.HasGetUint(path); has {
-		return v
+func (l *levelDBCache) IncrByFloatCtx(ctx context.Context, key string, step float64) (float64, error) {
+	if l.Next() != nil {
+		l.bloom.Add(key)
+		if err := l.Flush(ctx, key); err != nil {
+			return 0, err
+		}
+		v, err := l.Next().IncrByFloatCtx(ctx, key, step)
+		if err == nil {
+			_ = l.remove(key)
+		}
+		return v, err
 	}
-	return defaultValue
-}
 
-func (l *levelDBCache) DefaultGetUint8(path string, defaultValue uint8) uint8 {
-	if v, has := l.HasGetUint8(path); has {
-		return v
+	if l.Policy().ReadOnly {
+		return 0, cache.ErrReadOnly
 	}
-	return defaultValue
+	v := l.GetFloatCtx(ctx, key)
+	v = v + step
+	err := l.SetCtx(ctx, key, v)
+	return v, err
 }
 
-func (l *levelDBCache) DefaultGetUint16(path string, defaultValue uint16) uint16 {
-	if v, has := l.HasGetUint16(path); has {
-		return v
-	}
-	return defaultValue
+func (l *levelDBCache) EvictPrefix(prefixes ...string) error {
+	return l.EvictPrefixCtx(context.Background(), prefixes...)
 }
 
-func (l *levelDBCache) DefaultGetUint32(path string, defaultValue uint32) uint32 {
-	if v, has := l.HasGetUint32(path); has {
-		return v
+func (l *levelDBCache) EvictPrefixCtx(ctx context.Context, prefixes ...string) error {
+	var keys []string
+	for _, prefix := range prefixes {
+		iter := l.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+		for iter.Next() {
+			if err := ctx.Err(); err != nil {
+				iter.Release()
+				return err
+			}
+			if !isReserved(iter.Key()) {
+				keys = append(keys, string(iter.Key()))
+			}
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
 	}
-	return defaultValue
-}
-
-func (l *levelDBCache) DefaultGetUint64(path string, defaultValue uint64) uint64 {
-	if v, has := l.HasGetUint64(path); has {
-		return v
+	if len(keys) == 0 {
+		return nil
 	}
-	return defaultValue
+	return l.remove(keys...)
 }
 
-func (l *levelDBCache) DefaultGetFloat(path string, defaultValue float64) float64 {
-	if v, has := l.HasGetFloat(path); has {
-		return v
-	}
-	return defaultValue
+func (l *levelDBCache) SetIfAbsent(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return l.SetIfAbsentCtx(context.Background(), key, value, expiration...)
 }
 
-func (l *levelDBCache) DefaultGetFloat32(path string, defaultValue float32) float32 {
-	if v, has := l.HasGetFloat32(path); has {
-		return v
+func (l *levelDBCache) SetIfAbsentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	if l.Next() != nil {
+		l.bloom.Add(key)
+		if err := l.Flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := l.Next().SetIfAbsentCtx(ctx, key, value, expiration...)
+		if ok {
+			_ = l.remove(key)
+		}
+		return ok, err
 	}
-	return defaultValue
+	return l.setIf(ctx, key, value, expiration, func(cv *cache.Entry, has bool) (int64, bool) {
+		return 0, !has
+	})
 }
 
-func (l *levelDBCache) DefaultGetFloat64(path string, defaultValue float64) float64 {
-	if v, has := l.HasGetFloat64(path); has {
-		return v
-	}
-	return defaultValue
+func (l *levelDBCache) SetIfPresent(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return l.SetIfPresentCtx(context.Background(), key, value, expiration...)
 }
 
-func (l *levelDBCache) DefaultGetString(path string, defaultValue string) string {
-	if v, has := l.HasGetString(path); has {
-		return v
+func (l *levelDBCache) SetIfPresentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	if l.Next() != nil {
+		l.bloom.Add(key)
+		if err := l.Flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := l.Next().SetIfPresentCtx(ctx, key, value, expiration...)
+		if ok {
+			_ = l.remove(key)
+		}
+		return ok, err
 	}
-	return defaultValue
+	return l.setIf(ctx, key, value, expiration, func(cv *cache.Entry, has bool) (int64, bool) {
+		if !has {
+			return 0, false
+		}
+		return cv.Version, true
+	})
 }
 
-func (l *levelDBCache) DefaultGetBool(path string, defaultValue bool) bool {
-	if v, has := l.HasGetBool(path); has {
-		return v
-	}
-	return defaultValue
+func (l *levelDBCache) CompareAndSwap(key string, version int64, value interface{}, expiration ...time.Duration) (bool, error) {
+	return l.CompareAndSwapCtx(context.Background(), key, version, value, expiration...)
 }
 
-func (l *levelDBCache) DefaultGetTime(path string, defaultValue time.Time) time.Time {
-	if v, has := l.HasGetTime(path); has {
-		return v
+func (l *levelDBCache) CompareAndSwapCtx(ctx context.Context, key string, version int64, value interface{}, expiration ...time.Duration) (bool, error) {
+	if l.Next() != nil {
+		l.bloom.Add(key)
+		if err := l.Flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := l.Next().CompareAndSwapCtx(ctx, key, version, value, expiration...)
+		if ok {
+			_ = l.remove(key)
+		}
+		return ok, err
 	}
-	return defaultValue
+	return l.setIf(ctx, key, value, expiration, func(cv *cache.Entry, has bool) (int64, bool) {
+		return version, has && cv.Version == version
+	})
 }
 
-func (l *levelDBCache) Set(key string, value interface{}, expiration ...time.Duration) error {
-	s := json.Stringify(map[string]interface{}{"data": value}, false)
-	raw, _, _, err := jsonparser.Get([]byte(s), "data")
-	if err != nil {
-		return err
+// setIf 在 key 锁内根据当前值判断是否写入，cond 返回当前版本号及是否写入
+func (l *levelDBCache) setIf(ctx context.Context, key string, value interface{}, expiration []time.Duration, cond func(cv *cache.Entry, has bool) (int64, bool)) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if l.Policy().ReadOnly {
+		return false, cache.ErrReadOnly
 	}
-
 	var exp time.Duration
 	if len(expiration) > 0 {
 		exp = expiration[0]
 	}
-	cv := &levelDBCacheValue{
-		ExpiredDuration: exp,
-		CreatedAt:       time.Now(),
-		Data:            raw,
-	}
-	data, err := json.STD().Marshal(cv)
+	e, err := l.NewEntry(value, l.Policy().TTL(exp), cache.SetOptions{}, 0)
 	if err != nil {
-		return err
+		return false, err
 	}
-	err = l.db.Put([]byte(key), data, nil)
-	if err == nil && l.next != nil {
-		err = l.next.Set(key, value, expiration...)
-	}
-	return err
-}
 
-func (l *levelDBCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
-	keyword := []byte(s)
-	v, err := l.filter(func(key, value []byte) bool {
-		return bytes.HasPrefix(key, keyword)
-	}, limit...)
-
-	if err == nil && len(v) == 0 && l.next != nil {
-		return l.next.HasPrefix(s, limit...)
+	unlock := l.lockKeys(key)
+	cv, has := l.read(key)
+	prev, ok := cond(cv, has && !cv.Absent)
+	if !ok {
+		unlock()
+		return false, nil
 	}
-
-	return v, err
-}
-
-func (l *levelDBCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
-	keyword := []byte(s)
-	v, err := l.filter(func(key, value []byte) bool {
-		return bytes.HasSuffix(key, keyword)
-	}, limit...)
-
-	if err == nil && len(v) == 0 && l.next != nil {
-		return l.next.HasSuffix(s, limit...)
+	e.Version = cache.NewVersion(prev)
+	data, err := marshal(e)
+	if err == nil {
+		err = l.put(key, data)
 	}
-
-	return v, err
+	unlock()
+	l.enforce()
+	return err == nil, err
 }
 
-func (l *levelDBCache) Contains(s string, limit ...int) (map[string]string, error) {
-	keyword := []byte(s)
-	v, err := l.filter(func(key, value []byte) bool {
-		return bytes.Contains(key, keyword)
-	}, limit...)
-
-	if err == nil && len(v) == 0 && l.next != nil {
-		return l.next.Contains(s, limit...)
+// put 写入已编码的值并记录占用空间，调用方需持有 key 的分段锁
+func (l *levelDBCache) put(key string, data []byte) error {
+	l.bloom.Add(key)
+	if err := l.db.Put([]byte(key), data, nil); err != nil {
+		return err
 	}
-
-	return v, err
+	l.quota.add(key, int64(len(key)+len(data)))
+	return nil
 }
 
-func (l *levelDBCache) filter(filter func(key, value []byte) bool, limit ...int) (map[string]string, error) {
-	var max int
-	if len(limit) > 0 {
-		max = limit[0]
+// putBatch 批量写入已编码的值，写入后淘汰超出配额的 key
+func (l *levelDBCache) putBatch(values map[string][]byte) error {
+	var (
+		batch = new(leveldb.Batch)
+		keys  = make([]string, 0, len(values))
+	)
+	for key, data := range values {
+		batch.Put([]byte(key), data)
+		keys = append(keys, key)
 	}
-
-	var v = make(map[string]string)
-	iter := l.db.NewIterator(nil, nil)
-	for iter.Next() {
-		key := iter.Key()
-		value := iter.Value()
-		if filter(key, value) {
-			v[string(key)] = string(value)
-		}
-		if max > 0 && len(v) >= max {
-			break
+	l.bloom.Add(keys...)
+	unlock := l.lockKeys(keys...)
+	err := l.db.Write(batch, nil)
+	if err == nil {
+		for key, data := range values {
+			l.quota.add(key, int64(len(key)+len(data)))
 		}
 	}
-	iter.Release()
-	return v, iter.Error()
-}
-
-func (l *levelDBCache) incr(key string, step int) (int, error) {
-	v := l.GetInt(key)
-	v = v + step
-	err := l.Set(key, v)
-	return v, err
-}
-
-func (l *levelDBCache) Incr(key string) (int, error) {
-	if l.next != nil {
-		return l.next.Incr(key)
-	}
-
-	return l.incr(key, 1)
+	unlock()
+	l.enforce()
+	return err
 }
 
-func (l *levelDBCache) IncrBy(key string, step int) (int, error) {
-	if l.next != nil {
-		return l.next.IncrBy(key, step)
+// remove 仅删除本级的 key
+func (l *levelDBCache) remove(keys ...string) error {
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete([]byte(key))
 	}
+	unlock := l.lockKeys(keys...)
+	defer unlock()
 
-	return l.incr(key, step)
-}
-
-func (l *levelDBCache) IncrByFloat(key string, step float64) (float64, error) {
-	if l.next != nil {
-		return l.next.IncrByFloat(key, step)
+	if err := l.db.Write(batch, nil); err != nil {
+		return err
 	}
-
-	v := l.GetFloat(key)
-	v = v + step
-	err := l.Set(key, v)
-	return v, err
+	l.quota.remove(keys...)
+	return nil
 }
 
-func (l *levelDBCache) Del(keys ...string) error {
-	var err error
+// lockKeys 按固定顺序锁定 key 所在的分段锁，返回解锁函数
+func (l *levelDBCache) lockKeys(keys ...string) func() {
+	var (
+		seen    [lockStripes]bool
+		stripes []int
+	)
 	for _, key := range keys {
-		e := l.db.Delete([]byte(key), nil)
-		if err == nil && e != nil {
-			err = e
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		i := int(h.Sum32() % lockStripes)
+		if !seen[i] {
+			seen[i] = true
+			stripes = append(stripes, i)
 		}
 	}
-	if l.next != nil {
-		err = l.next.Del(keys...)
+	sort.Ints(stripes)
+	for _, i := range stripes {
+		l.locks[i].Lock()
+	}
+	return func() {
+		for _, i := range stripes {
+			l.locks[i].Unlock()
+		}
 	}
-	return err
-}
-
-func (l *levelDBCache) Next() cache.Cache {
-	return l.next
-}
-
-func (l *levelDBCache) SetNext(next cache.Cache) {
-	l.next = next
-}
-
-func (l *levelDBCache) Previous() cache.Cache {
-	return l.previous
-}
-
-func (l *levelDBCache) SetPrevious(previous cache.Cache) {
-	l.previous = previous
 }
 
 func (l *levelDBCache) Close() error {
+	l.closeOnce.Do(func() {
+		_ = l.Level.Close()
+		close(l.stop)
+		l.wg.Wait()
+	})
 	return l.db.Close()
 }
-
-func (l *levelDBCache) RemoteSupport() bool {
-	return false
-}
@@ -0,0 +1,68 @@
+package ldb
+
+import (
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"os"
+)
+
+// formatKey 记录数据格式版本的保留 key，不会出现在遍历结果中
+var formatKey = []byte("\x00cache:ldb:format")
+
+// formatVersion levelDBCacheValue 的编码方式变化时需要递增，版本不一致的数据库在打开时重建
+const formatVersion = "1"
+
+// openDB 打开数据库，persist 为 false 时清空目录中已有的数据；
+// 复用已有数据时，verify 为 true 则重建格式版本不一致的数据库，并删除所有已过期的 key
+func openDB(path string, options *opt.Options, persist, verify bool) (*leveldb.DB, error) {
+	if fi, err := os.Stat(path); err == nil {
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("leveldb/storage: open %s: not a directory", path)
+		}
+		if !persist {
+			if err := os.RemoveAll(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	db, err := leveldb.OpenFile(path, options)
+	if err != nil {
+		return nil, err
+	}
+	if persist {
+		if verify && !checkFormat(db) {
+			_ = db.Close()
+			if err := os.RemoveAll(path); err != nil {
+				return nil, err
+			}
+			if db, err = leveldb.OpenFile(path, options); err != nil {
+				return nil, err
+			}
+		} else if _, err := sweepExpired(db, defaultSweepBatch, nil, nil, nil); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	if err := db.Put(formatKey, []byte(formatVersion), nil); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkFormat 没有版本记录的空数据库视为可用
+func checkFormat(db *leveldb.DB) bool {
+	v, err := db.Get(formatKey, nil)
+	if err == leveldb.ErrNotFound {
+		iter := db.NewIterator(nil, nil)
+		defer iter.Release()
+		return !iter.Next()
+	}
+	return err == nil && string(v) == formatVersion
+}
+
+func isReserved(key []byte) bool {
+	return len(key) > 0 && key[0] == 0
+}
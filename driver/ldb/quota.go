@@ -0,0 +1,211 @@
+package ldb
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/iamdanielyin/cache/json"
+	"github.com/syndtr/goleveldb/leveldb"
+	"sort"
+	"sync"
+)
+
+type quotaEntry struct {
+	key  string
+	size int64
+}
+
+// quota 在内存中索引每个 key 占用的空间，超出 maxEntries 或 maxBytes 时淘汰队尾的 key；
+// oldest 策略下队首为最近写入的 key，lru 策略下读取也会移到队首
+type quota struct {
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+	lru        bool
+}
+
+// newQuota 未设置 maxEntries 及 maxBytes 时返回 nil，不维护索引；nil 的 quota 各方法均不做处理
+func newQuota(maxEntries int, maxBytes int64, policy string) (*quota, error) {
+	if maxEntries < 0 || maxBytes < 0 {
+		return nil, fmt.Errorf(`cache: invalid ldb options: max_entries=%d max_bytes=%d`, maxEntries, maxBytes)
+	}
+	var lru bool
+	switch policy {
+	case "", "oldest":
+	case "lru":
+		lru = true
+	default:
+		return nil, fmt.Errorf(`cache: unsupported ldb eviction: %s`, policy)
+	}
+	if maxEntries == 0 && maxBytes == 0 {
+		return nil, nil
+	}
+	return &quota{
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        lru,
+	}, nil
+}
+
+// load 按创建时间从旧到新索引已有的 key，复用数据库时使用
+func (q *quota) load(db *leveldb.DB) error {
+	if q == nil {
+		return nil
+	}
+	type loaded struct {
+		quotaEntry
+		createdAt int64
+	}
+	var entries []loaded
+	iter := db.NewIterator(nil, nil)
+	for iter.Next() {
+		if isReserved(iter.Key()) {
+			continue
+		}
+		var v levelDBCacheValue
+		_ = json.STD().Unmarshal(iter.Value(), &v)
+		entries = append(entries, loaded{
+			quotaEntry: quotaEntry{key: string(iter.Key()), size: int64(len(iter.Key()) + len(iter.Value()))},
+			createdAt:  v.CreatedAt.UnixNano(),
+		})
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].createdAt < entries[j].createdAt
+	})
+	for _, e := range entries {
+		q.add(e.key, e.size)
+	}
+	return nil
+}
+
+func (q *quota) add(key string, size int64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if elem, ok := q.items[key]; ok {
+		e := elem.Value.(*quotaEntry)
+		q.bytes += size - e.size
+		e.size = size
+		q.ll.MoveToFront(elem)
+		return
+	}
+	q.items[key] = q.ll.PushFront(&quotaEntry{key: key, size: size})
+	q.bytes += size
+}
+
+func (q *quota) touch(key string) {
+	if q == nil || !q.lru {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if elem, ok := q.items[key]; ok {
+		q.ll.MoveToFront(elem)
+	}
+}
+
+func (q *quota) has(key string) bool {
+	if q == nil {
+		return false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, ok := q.items[key]
+	return ok
+}
+
+func (q *quota) remove(keys ...string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, key := range keys {
+		if elem, ok := q.items[key]; ok {
+			q.removeElement(elem)
+		}
+	}
+}
+
+// victims 从索引中移除超出配额的 key 并返回，由调用方从数据库中删除
+func (q *quota) victims() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var keys []string
+	for q.ll.Len() > 0 && ((q.maxEntries > 0 && q.ll.Len() > q.maxEntries) || (q.maxBytes > 0 && q.bytes > q.maxBytes)) {
+		elem := q.ll.Back()
+		keys = append(keys, elem.Value.(*quotaEntry).key)
+		q.removeElement(elem)
+	}
+	return keys
+}
+
+func (q *quota) usage() (int, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.ll.Len(), q.bytes
+}
+
+func (q *quota) removeElement(elem *list.Element) {
+	e := q.ll.Remove(elem).(*quotaEntry)
+	delete(q.items, e.key)
+	q.bytes -= e.size
+}
+
+// Usage 返回当前数据库的条目数及字节数，未设置配额时遍历数据库统计
+func (l *levelDBCache) Usage() (int, int64) {
+	if l.quota != nil {
+		return l.quota.usage()
+	}
+	var (
+		entries int
+		bytes   int64
+	)
+	iter := l.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if !isReserved(iter.Key()) {
+			entries++
+			bytes += int64(len(iter.Key()) + len(iter.Value()))
+		}
+	}
+	return entries, bytes
+}
+
+// enforce 删除超出配额的 key，调用方不能持有分段锁
+func (l *levelDBCache) enforce() {
+	keys := l.quota.victims()
+	if len(keys) == 0 {
+		return
+	}
+	unlock := l.lockKeys(keys...)
+	defer unlock()
+
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		// 淘汰期间被重新写入的 key 予以保留
+		if !l.quota.has(key) {
+			batch.Delete([]byte(key))
+		}
+	}
+	_ = l.db.Write(batch, nil)
+}
@@ -0,0 +1,113 @@
+package ldb
+
+import (
+	"github.com/iamdanielyin/cache/json"
+	"github.com/syndtr/goleveldb/leveldb"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSweepBatch = 1000
+
+// Sweep 立即清理一次已过期的 key，返回本次删除的数量
+func (l *levelDBCache) Sweep() (int, error) {
+	n, err := sweepExpired(l.db, l.sweepBatch, l.lockKeys, l.quota.remove, l.stop)
+	atomic.AddInt64(&l.reclaimed, int64(n))
+	return n, err
+}
+
+// Reclaimed 返回累计清理的过期 key 数量
+func (l *levelDBCache) Reclaimed() int64 {
+	return atomic.LoadInt64(&l.reclaimed)
+}
+
+// startSweeper 按 interval 定时清理过期的 key，直到 Close 被调用
+func (l *levelDBCache) startSweeper(interval time.Duration) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				_, _ = l.Sweep()
+			}
+		}
+	}()
+}
+
+// sweepExpired 遍历数据库，每凑满 batchSize 个已过期或无法解析的 key 后加锁复查并批量删除；
+// 删除的 key 会传给 removed，stop 关闭时在当前批次结束后返回
+func sweepExpired(db *leveldb.DB, batchSize int, lock func(keys ...string) func(), removed func(keys ...string), stop <-chan struct{}) (int, error) {
+	if batchSize <= 0 {
+		batchSize = defaultSweepBatch
+	}
+	var (
+		total int
+		keys  = make([]string, 0, batchSize)
+	)
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		if lock != nil {
+			defer lock(keys...)()
+		}
+		// 遍历使用的是快照，删除前需要确认 key 没有被重新写入
+		var (
+			batch   = new(leveldb.Batch)
+			deleted []string
+		)
+		for _, key := range keys {
+			if data, err := db.Get([]byte(key), nil); err == nil && stale(data) {
+				batch.Delete([]byte(key))
+				deleted = append(deleted, key)
+			}
+		}
+		keys = keys[:0]
+		if len(deleted) == 0 {
+			return nil
+		}
+		if err := db.Write(batch, nil); err != nil {
+			return err
+		}
+		if removed != nil {
+			removed(deleted...)
+		}
+		total += len(deleted)
+		return nil
+	}
+
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if isReserved(iter.Key()) || !stale(iter.Value()) {
+			continue
+		}
+		keys = append(keys, string(iter.Key()))
+		if len(keys) < batchSize {
+			continue
+		}
+		if err := flush(); err != nil {
+			return total, err
+		}
+		select {
+		case <-stop:
+			return total, nil
+		default:
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return total, err
+	}
+	return total, flush()
+}
+
+func stale(data []byte) bool {
+	var v levelDBCacheValue
+	return json.STD().Unmarshal(data, &v) != nil || v.expired()
+}
@@ -0,0 +1,330 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/iamdanielyin/cache"
+	"strings"
+	"time"
+)
+
+func init() {
+	cache.RegisterDriver(&memoryDriver{})
+}
+
+type memoryDriver struct{}
+
+func (d *memoryDriver) Name() string {
+	return "memory"
+}
+
+func (d *memoryDriver) NewCache(m map[string]interface{}) (cache.Cache, error) {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	var (
+		maxEntries = cache.IntOption(m, "max_entries")
+		maxBytes   = cache.IntOption(m, "max_bytes")
+	)
+	if maxEntries < 0 || maxBytes < 0 {
+		return nil, fmt.Errorf(`cache: invalid memory options: max_entries=%d max_bytes=%d`, maxEntries, maxBytes)
+	}
+	name, _ := m["policy"].(string)
+	s, err := newShardedStore(cache.IntOption(m, "shards"), maxEntries, int64(maxBytes), name)
+	if err != nil {
+		return nil, err
+	}
+	inst := &memoryCache{store: s}
+	if inst.Level, err = cache.NewLevel(inst, s, m); err != nil {
+		return nil, err
+	}
+	return inst, nil
+}
+
+var ErrUnsupportedPubSub = cache.ErrUnsupportedPubSub
+
+type memoryCache struct {
+	*cache.Level
+	store *shardedStore
+}
+
+// Usage 返回当前缓存的条目数及字节数
+func (m *memoryCache) Usage() (int, int64) {
+	return m.store.usage()
+}
+
+func (m *memoryCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
+	return m.HasPrefixCtx(context.Background(), s, limit...)
+}
+
+func (m *memoryCache) HasPrefixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	v, err := m.filter(ctx, func(key string) bool {
+		return strings.HasPrefix(key, s)
+	}, limit...)
+
+	if err == nil && len(v) == 0 && m.Next() != nil {
+		return m.Next().HasPrefixCtx(ctx, s, limit...)
+	}
+
+	return v, err
+}
+
+func (m *memoryCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
+	return m.HasSuffixCtx(context.Background(), s, limit...)
+}
+
+func (m *memoryCache) HasSuffixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	v, err := m.filter(ctx, func(key string) bool {
+		return strings.HasSuffix(key, s)
+	}, limit...)
+
+	if err == nil && len(v) == 0 && m.Next() != nil {
+		return m.Next().HasSuffixCtx(ctx, s, limit...)
+	}
+
+	return v, err
+}
+
+func (m *memoryCache) Contains(s string, limit ...int) (map[string]string, error) {
+	return m.ContainsCtx(context.Background(), s, limit...)
+}
+
+func (m *memoryCache) ContainsCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	v, err := m.filter(ctx, func(key string) bool {
+		return strings.Contains(key, s)
+	}, limit...)
+
+	if err == nil && len(v) == 0 && m.Next() != nil {
+		return m.Next().ContainsCtx(ctx, s, limit...)
+	}
+
+	return v, err
+}
+
+func (m *memoryCache) filter(ctx context.Context, filter func(key string) bool, limit ...int) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var max int
+	if len(limit) > 0 {
+		max = limit[0]
+	}
+
+	var v = make(map[string]string)
+	m.store.scan(func(key string, cv *cache.Entry) bool {
+		if !cv.Absent && filter(key) {
+			v[key] = string(cv.Data)
+		}
+		return max <= 0 || len(v) < max
+	})
+	return v, nil
+}
+
+func (m *memoryCache) Incr(key string) (int, error) {
+	return m.IncrCtx(context.Background(), key)
+}
+
+func (m *memoryCache) IncrCtx(ctx context.Context, key string) (int, error) {
+	return m.IncrByCtx(ctx, key, 1)
+}
+
+func (m *memoryCache) IncrBy(key string, step int) (int, error) {
+	return m.IncrByCtx(context.Background(), key, step)
+}
+
+func (m *memoryCache) IncrByCtx(ctx context.Context, key string, step int) (int, error) {
+	if m.Next() != nil {
+		if err := m.Flush(ctx, key); err != nil {
+			return 0, err
+		}
+		v, err := m.Next().IncrByCtx(ctx, key, step)
+		if err == nil {
+			m.store.del(key)
+		}
+		return v, err
+	}
+
+	if m.Policy().ReadOnly {
+		return 0, cache.ErrReadOnly
+	}
+	var v int64
+	err := m.incr(ctx, key, func(old *cache.Entry) interface{} {
+		if old != nil {
+			v, _ = old.Int()
+		}
+		v += int64(step)
+		return v
+	})
+	return int(v), err
+}
+
+func (m *memoryCache) IncrByFloat(key string, step float64) (float64, error) {
+	return m.IncrByFloatCtx(context.Background(), key, step)
+}
+
+func (m *memoryCache) IncrByFloatCtx(ctx context.Context, key string, step float64) (float64, error) {
+	if m.Next() != nil {
+		if err := m.Flush(ctx, key); err != nil {
+			return 0, err
+		}
+		v, err := m.Next().IncrByFloatCtx(ctx, key, step)
+		if err == nil {
+			m.store.del(key)
+		}
+		return v, err
+	}
+
+	if m.Policy().ReadOnly {
+		return 0, cache.ErrReadOnly
+	}
+	var v float64
+	err := m.incr(ctx, key, func(old *cache.Entry) interface{} {
+		if old != nil {
+			v, _ = old.Float()
+		}
+		v += step
+		return v
+	})
+	return v, err
+}
+
+// incr 在锁内原子地修改数值，保留原有的过期时间；fn 收到的 old 在 key 不存在时为 nil
+func (m *memoryCache) incr(ctx context.Context, key string, fn func(old *cache.Entry) interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	m.store.update(key, func(old *cache.Entry, has bool) (*cache.Entry, bool) {
+		if !has || old.Absent {
+			old = nil
+		}
+		var e *cache.Entry
+		if e, err = m.NewEntry(fn(old), 0, cache.SetOptions{}, cache.NewVersion(0)); err != nil {
+			return nil, false
+		}
+		if old != nil {
+			e.Meta = old.Meta
+			e.Version = cache.NewVersion(old.Version)
+		}
+		return e, true
+	})
+	return err
+}
+
+func (m *memoryCache) EvictPrefix(prefixes ...string) error {
+	return m.EvictPrefixCtx(context.Background(), prefixes...)
+}
+
+func (m *memoryCache) EvictPrefixCtx(ctx context.Context, prefixes ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var keys []string
+	m.store.scan(func(key string, value *cache.Entry) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+				break
+			}
+		}
+		return true
+	})
+	m.store.del(keys...)
+	return nil
+}
+
+func (m *memoryCache) SetIfAbsent(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return m.SetIfAbsentCtx(context.Background(), key, value, expiration...)
+}
+
+func (m *memoryCache) SetIfAbsentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	if m.Next() != nil {
+		if err := m.Flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := m.Next().SetIfAbsentCtx(ctx, key, value, expiration...)
+		if ok {
+			m.store.del(key)
+		}
+		return ok, err
+	}
+	return m.setIf(ctx, key, value, expiration, func(cv *cache.Entry, has bool) (int64, bool) {
+		return 0, !has
+	})
+}
+
+func (m *memoryCache) SetIfPresent(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return m.SetIfPresentCtx(context.Background(), key, value, expiration...)
+}
+
+func (m *memoryCache) SetIfPresentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	if m.Next() != nil {
+		if err := m.Flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := m.Next().SetIfPresentCtx(ctx, key, value, expiration...)
+		if ok {
+			m.store.del(key)
+		}
+		return ok, err
+	}
+	return m.setIf(ctx, key, value, expiration, func(cv *cache.Entry, has bool) (int64, bool) {
+		if !has {
+			return 0, false
+		}
+		return cv.Version, true
+	})
+}
+
+func (m *memoryCache) CompareAndSwap(key string, version int64, value interface{}, expiration ...time.Duration) (bool, error) {
+	return m.CompareAndSwapCtx(context.Background(), key, version, value, expiration...)
+}
+
+func (m *memoryCache) CompareAndSwapCtx(ctx context.Context, key string, version int64, value interface{}, expiration ...time.Duration) (bool, error) {
+	if m.Next() != nil {
+		if err := m.Flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := m.Next().CompareAndSwapCtx(ctx, key, version, value, expiration...)
+		if ok {
+			m.store.del(key)
+		}
+		return ok, err
+	}
+	return m.setIf(ctx, key, value, expiration, func(cv *cache.Entry, has bool) (int64, bool) {
+		return version, has && cv.Version == version
+	})
+}
+
+// setIf 在锁内根据当前值判断是否写入，cond 返回当前版本号及是否写入
+func (m *memoryCache) setIf(ctx context.Context, key string, value interface{}, expiration []time.Duration, cond func(cv *cache.Entry, has bool) (int64, bool)) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if m.Policy().ReadOnly {
+		return false, cache.ErrReadOnly
+	}
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	exp = m.Policy().TTL(exp)
+	e, err := m.NewEntry(value, exp, cache.SetOptions{}, 0)
+	if err != nil {
+		return false, err
+	}
+	return m.store.update(key, func(old *cache.Entry, has bool) (*cache.Entry, bool) {
+		prev, ok := cond(old, has && !old.Absent)
+		if !ok {
+			return nil, false
+		}
+		e.Version = cache.NewVersion(prev)
+		return e, true
+	}), nil
+}
+
+func (m *memoryCache) Close() error {
+	_ = m.Level.Close()
+	m.store.clear()
+	return nil
+}
@@ -0,0 +1,245 @@
+package memory
+
+import (
+	"container/list"
+	"fmt"
+	"hash/maphash"
+)
+
+// policy 淘汰策略，所有方法均在 store 的锁内调用
+type policy interface {
+	insert(item *storeItem)
+	hit(item *storeItem)
+	miss(key string)
+	remove(item *storeItem)
+	// victim 返回容量超出时应淘汰的 key
+	victim() *storeItem
+}
+
+func newPolicy(name string, maxEntries int) (policy, error) {
+	switch name {
+	case "", "lru":
+		return newLRUPolicy(), nil
+	case "tinylfu", "wtinylfu":
+		return newTinyLFUPolicy(maxEntries), nil
+	}
+	return nil, fmt.Errorf(`cache: unsupported memory policy: %s`, name)
+}
+
+type lruPolicy struct {
+	ll *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{ll: list.New()}
+}
+
+func (p *lruPolicy) insert(item *storeItem) {
+	item.elem = p.ll.PushFront(item)
+}
+
+func (p *lruPolicy) hit(item *storeItem) {
+	p.ll.MoveToFront(item.elem)
+}
+
+func (p *lruPolicy) miss(string) {}
+
+func (p *lruPolicy) remove(item *storeItem) {
+	p.ll.Remove(item.elem)
+}
+
+func (p *lruPolicy) victim() *storeItem {
+	return p.ll.Back().Value.(*storeItem)
+}
+
+const (
+	segmentWindow uint8 = iota
+	segmentProbation
+	segmentProtected
+)
+
+// tinyLFUPolicy W-TinyLFU：新写入的 key 先进入窗口 LRU，被挤出窗口后
+// 只有访问频率高于主区域待淘汰 key 时才会被接纳，避免一次性扫描污染缓存
+type tinyLFUPolicy struct {
+	window     *list.List
+	probation  *list.List
+	protected  *list.List
+	sketch     *countMinSketch
+	maxEntries int
+	// 最近一个被挤出窗口、尚未经过淘汰比较的 key
+	candidate *storeItem
+}
+
+func newTinyLFUPolicy(maxEntries int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		window:     list.New(),
+		probation:  list.New(),
+		protected:  list.New(),
+		sketch:     newCountMinSketch(maxEntries),
+		maxEntries: maxEntries,
+	}
+}
+
+func (p *tinyLFUPolicy) insert(item *storeItem) {
+	p.sketch.add(item.key)
+	item.segment = segmentWindow
+	item.elem = p.window.PushFront(item)
+
+	// 窗口占总容量的 1%，超出时最久未访问的 key 移入试用区成为候选者
+	capacity := p.maxEntries
+	if capacity <= 0 {
+		capacity = p.window.Len() + p.probation.Len() + p.protected.Len()
+	}
+	windowSize := capacity / 100
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	for p.window.Len() > windowSize {
+		candidate := p.window.Back().Value.(*storeItem)
+		p.window.Remove(candidate.elem)
+		candidate.segment = segmentProbation
+		candidate.elem = p.probation.PushFront(candidate)
+		p.candidate = candidate
+	}
+}
+
+func (p *tinyLFUPolicy) hit(item *storeItem) {
+	p.sketch.add(item.key)
+	switch item.segment {
+	case segmentWindow:
+		p.window.MoveToFront(item.elem)
+	case segmentProbation:
+		// 再次命中后晋升到保护区，保护区超出主区域的 80% 时降级最久未访问的 key
+		p.probation.Remove(item.elem)
+		item.segment = segmentProtected
+		item.elem = p.protected.PushFront(item)
+		if p.protected.Len() > (p.probation.Len()+p.protected.Len())*4/5 {
+			demoted := p.protected.Back().Value.(*storeItem)
+			p.protected.Remove(demoted.elem)
+			demoted.segment = segmentProbation
+			demoted.elem = p.probation.PushFront(demoted)
+		}
+	case segmentProtected:
+		p.protected.MoveToFront(item.elem)
+	}
+}
+
+func (p *tinyLFUPolicy) miss(key string) {
+	p.sketch.add(key)
+}
+
+func (p *tinyLFUPolicy) remove(item *storeItem) {
+	p.segmentList(item.segment).Remove(item.elem)
+	if p.candidate == item {
+		p.candidate = nil
+	}
+}
+
+// victim 候选者与试用区中最久未访问的 key 比较访问频率，淘汰频率较低者
+func (p *tinyLFUPolicy) victim() *storeItem {
+	candidate := p.candidate
+	p.candidate = nil
+
+	victim := p.mainVictim()
+	if victim == nil {
+		return p.window.Back().Value.(*storeItem)
+	}
+	if candidate == nil || candidate == victim || candidate.segment != segmentProbation {
+		return victim
+	}
+	if p.sketch.estimate(candidate.key) > p.sketch.estimate(victim.key) {
+		return victim
+	}
+	return candidate
+}
+
+func (p *tinyLFUPolicy) mainVictim() *storeItem {
+	if e := p.probation.Back(); e != nil {
+		return e.Value.(*storeItem)
+	}
+	if e := p.protected.Back(); e != nil {
+		return e.Value.(*storeItem)
+	}
+	return nil
+}
+
+func (p *tinyLFUPolicy) segmentList(segment uint8) *list.List {
+	switch segment {
+	case segmentProbation:
+		return p.probation
+	case segmentProtected:
+		return p.protected
+	}
+	return p.window
+}
+
+const sketchDepth = 4
+
+// countMinSketch 近似统计访问频率，计数上限为 15，
+// 累计记录次数达到阈值后所有计数减半，使频率随时间衰减
+type countMinSketch struct {
+	seed    maphash.Seed
+	rows    [sketchDepth][]uint8
+	mask    uint64
+	added   int
+	resetAt int
+}
+
+func newCountMinSketch(size int) *countMinSketch {
+	width := 1024
+	for width < size {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		seed:    maphash.MakeSeed(),
+		mask:    uint64(width - 1),
+		resetAt: width * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) index(key string) [sketchDepth]uint64 {
+	var mh maphash.Hash
+	mh.SetSeed(s.seed)
+	_, _ = mh.WriteString(key)
+	h := mh.Sum64()
+	h1, h2 := h&0xffffffff, h>>32
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) add(key string) {
+	for i, j := range s.index(key) {
+		if s.rows[i][j] < 15 {
+			s.rows[i][j]++
+		}
+	}
+	if s.added++; s.added >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(15)
+	for i, j := range s.index(key) {
+		if v := s.rows[i][j]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.added /= 2
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"github.com/iamdanielyin/cache"
+	"hash/maphash"
+)
+
+const (
+	defaultShards     = 16
+	minShardEntries   = 64
+	minShardBytes     = 64 << 10
+	maxShardsPerCache = 1024
+)
+
+// shardedStore 按 key 的哈希值将数据分散到多个 store，每个分片独立加锁和淘汰
+type shardedStore struct {
+	seed   maphash.Seed
+	shards []*store
+	mask   uint64
+}
+
+// newShardedStore 各分片的容量之和等于 maxEntries 及 maxBytes，每个分片独立淘汰，
+// 因此分片未写满时其他分片也可能已开始淘汰；分片数不超过容量上限，保证每个分片的容量至少为 1
+func newShardedStore(shards, maxEntries int, maxBytes int64, policyName string) (*shardedStore, error) {
+	if shards <= 0 {
+		// 未指定分片数时保证每个分片有足够的容量，避免容量较小时淘汰过于激进
+		shards = defaultShards
+		for shards > 1 && ((maxEntries > 0 && maxEntries/shards < minShardEntries) ||
+			(maxBytes > 0 && maxBytes/int64(shards) < minShardBytes)) {
+			shards >>= 1
+		}
+	}
+	n := 1
+	for n < shards && n < maxShardsPerCache {
+		n <<= 1
+	}
+	// 分片的容量为 0 时不限制，分片数不能超过容量上限
+	for n > 1 && ((maxEntries > 0 && n > maxEntries) || (maxBytes > 0 && int64(n) > maxBytes)) {
+		n >>= 1
+	}
+
+	s := &shardedStore{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*store, n),
+		mask:   uint64(n - 1),
+	}
+	for i := range s.shards {
+		shardEntries := int(split(int64(maxEntries), n, i))
+		p, err := newPolicy(policyName, shardEntries)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = newStore(shardEntries, split(maxBytes, n, i), p)
+	}
+	return s, nil
+}
+
+// split 将容量 total 分给 n 个分片，返回第 i 个分片的容量，余数分给前面的分片
+func split(total int64, n, i int) int64 {
+	v := total / int64(n)
+	if int64(i) < total%int64(n) {
+		v++
+	}
+	return v
+}
+
+func (s *shardedStore) shard(key string) *store {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	var h maphash.Hash
+	h.SetSeed(s.seed)
+	_, _ = h.WriteString(key)
+	return s.shards[h.Sum64()&s.mask]
+}
+
+func (s *shardedStore) get(key string) (*cache.Entry, bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedStore) set(key string, value *cache.Entry) {
+	s.shard(key).set(key, value)
+}
+
+// Get 实现 cache.Backend
+func (s *shardedStore) Get(key string) (*cache.Entry, bool) {
+	return s.get(key)
+}
+
+// Put 实现 cache.Backend
+func (s *shardedStore) Put(key string, e *cache.Entry) error {
+	s.set(key, e)
+	return nil
+}
+
+// Delete 实现 cache.Backend
+func (s *shardedStore) Delete(keys ...string) error {
+	s.del(keys...)
+	return nil
+}
+
+func (s *shardedStore) update(key string, fn func(old *cache.Entry, has bool) (*cache.Entry, bool)) bool {
+	return s.shard(key).update(key, fn)
+}
+
+func (s *shardedStore) del(keys ...string) {
+	if len(s.shards) == 1 {
+		s.shards[0].del(keys...)
+		return
+	}
+	for _, key := range keys {
+		s.shard(key).del(key)
+	}
+}
+
+// scan 依次遍历各分片，fn 返回 false 时停止
+func (s *shardedStore) scan(fn func(key string, value *cache.Entry) bool) {
+	stopped := false
+	for _, shard := range s.shards {
+		shard.scan(func(key string, value *cache.Entry) bool {
+			stopped = !fn(key, value)
+			return !stopped
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+func (s *shardedStore) usage() (int, int64) {
+	var (
+		entries int
+		bytes   int64
+	)
+	for _, shard := range s.shards {
+		n, b := shard.usage()
+		entries += n
+		bytes += b
+	}
+	return entries, bytes
+}
+
+func (s *shardedStore) clear() {
+	for _, shard := range s.shards {
+		shard.clear()
+	}
+}
@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"container/list"
+	"github.com/iamdanielyin/cache"
+	"sync"
+)
+
+type storeItem struct {
+	key   string
+	value *cache.Entry
+	size  int64
+
+	// 由淘汰策略维护
+	elem    *list.Element
+	segment uint8
+}
+
+// store 带容量限制的存储，超出 maxEntries 或 maxBytes 时由 policy 决定淘汰的 key
+type store struct {
+	mu         sync.Mutex
+	items      map[string]*storeItem
+	policy     policy
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+}
+
+func newStore(maxEntries int, maxBytes int64, p policy) *store {
+	return &store{
+		items:      make(map[string]*storeItem),
+		policy:     p,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+func (s *store) get(key string) (*cache.Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getLocked(key)
+}
+
+func (s *store) getLocked(key string) (*cache.Entry, bool) {
+	item, ok := s.items[key]
+	if !ok {
+		s.policy.miss(key)
+		return nil, false
+	}
+	if item.value.Expired() {
+		s.removeItem(item)
+		return nil, false
+	}
+	s.policy.hit(item)
+	return item.value, true
+}
+
+func (s *store) set(key string, value *cache.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setLocked(key, value)
+}
+
+func (s *store) setLocked(key string, value *cache.Entry) {
+	size := int64(len(key) + len(value.Data))
+	if s.maxBytes > 0 && size > s.maxBytes {
+		// 单个值超出容量时不缓存
+		if item, ok := s.items[key]; ok {
+			s.removeItem(item)
+		}
+		return
+	}
+	if item, ok := s.items[key]; ok {
+		s.bytes += size - item.size
+		item.value = value
+		item.size = size
+		s.policy.hit(item)
+	} else {
+		item = &storeItem{key: key, value: value, size: size}
+		s.items[key] = item
+		s.bytes += size
+		s.policy.insert(item)
+	}
+	for s.overflow() {
+		s.removeItem(s.policy.victim())
+	}
+}
+
+// update 在锁内读取当前值并由 fn 决定是否写入新值
+func (s *store) update(key string, fn func(old *cache.Entry, has bool) (*cache.Entry, bool)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, has := s.getLocked(key)
+	value, ok := fn(old, has)
+	if ok {
+		s.setLocked(key, value)
+	}
+	return ok
+}
+
+func (s *store) del(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if item, ok := s.items[key]; ok {
+			s.removeItem(item)
+		}
+	}
+}
+
+// scan 遍历未过期的 key，fn 返回 false 时停止；遍历不影响淘汰顺序
+func (s *store) scan(fn func(key string, value *cache.Entry) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, item := range s.items {
+		if item.value.Expired() {
+			s.removeItem(item)
+		} else if !fn(key, item.value) {
+			return
+		}
+	}
+}
+
+func (s *store) usage() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.items), s.bytes
+}
+
+func (s *store) overflow() bool {
+	if len(s.items) == 0 {
+		return false
+	}
+	return (s.maxEntries > 0 && len(s.items) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+func (s *store) removeItem(item *storeItem) {
+	s.policy.remove(item)
+	delete(s.items, item.key)
+	s.bytes -= item.size
+}
+
+func (s *store) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, item := range s.items {
+		s.policy.remove(item)
+	}
+	s.items = make(map[string]*storeItem)
+	s.bytes = 0
+}
@@ -0,0 +1,234 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/iamdanielyin/cache"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 订阅断线重连后的处理策略
+const (
+	// reconnectFlush 清空上一级及之前各级的本地缓存
+	reconnectFlush = "flush"
+	// reconnectReplay 从失效日志中补发断线期间错过的消息，日志不完整时退化为 flush
+	reconnectReplay = "replay"
+	// reconnectNone 不做处理
+	reconnectNone = "none"
+)
+
+const (
+	defaultLogSize   = 10000
+	replayBatch      = 1000
+	subscribeTimeout = 30 * time.Second
+)
+
+var errLogTrimmed = errors.New(`cache: invalidation log trimmed`)
+
+// invalidationLog 基于 Redis Stream 的失效消息日志，消息 ID 即序号；
+// 使用 replay 策略时所有节点都需要开启，广播前先写入日志
+type invalidationLog struct {
+	key    string
+	maxLen int64
+	mu     sync.Mutex
+	// 最近处理过的消息序号
+	last string
+}
+
+func parseReconnect(config map[string]interface{}) (string, *invalidationLog, error) {
+	policy, _ := config["on_reconnect"].(string)
+	switch policy {
+	case "":
+		policy = reconnectFlush
+	case reconnectFlush, reconnectNone:
+	case reconnectReplay:
+		log := &invalidationLog{key: connectChannel + ":log", maxLen: int64(cache.IntOption(config, "invalidation_log_size"))}
+		if key, _ := config["invalidation_log"].(string); key != "" {
+			log.key = key
+		}
+		if log.maxLen <= 0 {
+			log.maxLen = defaultLogSize
+		}
+		return policy, log, nil
+	default:
+		return "", nil, fmt.Errorf(`cache: unsupported redis on_reconnect policy: %s`, policy)
+	}
+	return policy, nil, nil
+}
+
+func (l *invalidationLog) advance(seq string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if compareSeq(seq, l.last) > 0 {
+		l.last = seq
+	}
+}
+
+func (l *invalidationLog) lastSeq() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.last
+}
+
+// compareSeq 比较 Stream 消息 ID（毫秒时间戳-序号）
+func compareSeq(a, b string) int {
+	am, as := splitSeq(a)
+	bm, bs := splitSeq(b)
+	switch {
+	case am != bm:
+		if am < bm {
+			return -1
+		}
+		return 1
+	case as != bs:
+		if as < bs {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func splitSeq(seq string) (uint64, uint64) {
+	ms, n, _ := strings.Cut(seq, "-")
+	a, _ := strconv.ParseUint(ms, 10, 64)
+	b, _ := strconv.ParseUint(n, 10, 64)
+	return a, b
+}
+
+// subscribeInvalidations 订阅 CONNECT_CHANNEL；go-redis 断线后会自动重连并重新订阅，
+// 收到重复的订阅确认即说明期间可能错过了消息
+func (r *redisCache) subscribeInvalidations(ctx context.Context) error {
+	ps := r.subscriber().Subscribe(ctx, connectChannel)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return err
+	}
+	if r.log != nil {
+		// 从订阅时日志的最新位置开始记录
+		msgs, err := r.client().XRevRangeN(ctx, r.log.key, "+", "-", 1).Result()
+		if err != nil {
+			_ = ps.Close()
+			return err
+		}
+		r.log.last = "0-0"
+		if len(msgs) > 0 {
+			r.log.last = msgs[0].ID
+		}
+	}
+	r.pubsub = ps
+
+	go func() {
+		ctx := context.Background()
+		for {
+			msg, err := ps.ReceiveTimeout(ctx, subscribeTimeout)
+			if err != nil {
+				if err == redis.ErrClosed {
+					return
+				}
+				// 长时间没有消息时发送 PING 检测连接，失败后下次读取会重连
+				if e, ok := err.(net.Error); ok && e.Timeout() {
+					_ = ps.Ping(ctx)
+				} else {
+					time.Sleep(100 * time.Millisecond)
+				}
+				continue
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind == "subscribe" {
+					r.recover(ctx)
+				}
+			case *redis.Message:
+				if inv, err := cache.ParseInvalidation(m.Payload); err == nil {
+					r.handleInvalidation(ctx, inv)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *redisCache) handleInvalidation(ctx context.Context, inv *cache.Invalidation) {
+	if !r.last() {
+		return
+	}
+	if r.log != nil && inv.Seq != "" {
+		r.log.advance(inv.Seq)
+	}
+	// 本节点写入时上一级已是最新值，无需删除
+	if inv.Origin == r.nodeID || inv.Empty() {
+		return
+	}
+	_ = cache.Invalidate(ctx, r, inv)
+}
+
+// recover 重新订阅后按策略处理断线期间可能错过的失效消息
+func (r *redisCache) recover(ctx context.Context) {
+	if !r.last() {
+		return
+	}
+	switch r.onReconnect {
+	case reconnectNone:
+		return
+	case reconnectReplay:
+		if err := r.replay(ctx); err == nil {
+			return
+		}
+	}
+	_ = cache.Invalidate(ctx, r, &cache.Invalidation{Op: cache.InvalidationDel, Prefixes: []string{""}})
+}
+
+// replay 补发日志中序号大于最近处理过的消息，最近处理过的消息已被裁剪时返回 errLogTrimmed
+func (r *redisCache) replay(ctx context.Context) error {
+	last := r.log.lastSeq()
+	if last == "0-0" {
+		n, err := r.client().XLen(ctx, r.log.key).Result()
+		if err != nil {
+			return err
+		}
+		if n >= r.log.maxLen {
+			return errLogTrimmed
+		}
+	} else {
+		msgs, err := r.client().XRange(ctx, r.log.key, last, last).Result()
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			return errLogTrimmed
+		}
+	}
+
+	start := last
+	for {
+		msgs, err := r.client().XRangeN(ctx, r.log.key, start, "+", replayBatch).Result()
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if compareSeq(msg.ID, start) <= 0 {
+				continue
+			}
+			start = msg.ID
+			data, _ := msg.Values["msg"].(string)
+			inv, err := cache.ParseInvalidation(data)
+			if err != nil {
+				continue
+			}
+			inv.Seq = msg.ID
+			r.handleInvalidation(ctx, inv)
+		}
+		if len(msgs) < replayBatch {
+			return nil
+		}
+	}
+}
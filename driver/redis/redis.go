@@ -2,11 +2,17 @@ package redis
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	stdjson "encoding/json"
 	"fmt"
 	"github.com/go-redis/redis/v8"
 	"github.com/iamdanielyin/cache"
 	"github.com/iamdanielyin/cache/json"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,32 +35,220 @@ func (r *redisDriver) NewCache(config map[string]interface{}) (cache.Cache, erro
 		return nil, fmt.Errorf(`cache: parse redis options failed: %s`, err.Error())
 	}
 
-	cmd := redis.NewUniversalClient(opts)
-	if _, err := cmd.Ping(context.Background()).Result(); err != nil {
+	onReconnect, log, err := parseReconnect(config)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := cache.ParseCodec(config)
+	if err != nil {
 		return nil, err
 	}
-	inst := &redisCache{rdb: cmd}
-	err := inst.Subscribe([]string{connectChannel}, func(channel string, data string) {
-		if data == "" {
-			return
+	// 布隆过滤器只记录本进程的写入，不能用于其他节点也会写入的 Redis
+	if cache.ParseBloomFilterOptions(config) != nil {
+		return nil, fmt.Errorf(`cache: bloom_filter is not supported by redis levels`)
+	}
+
+	// tracking 为 default 或 bcast 时开启 CLIENT TRACKING，服务端不支持时仅使用 CONNECT_CHANNEL
+	var t *tracking
+	switch mode, _ := config["tracking"].(string); mode {
+	case "":
+	case "default", "bcast":
+		var err error
+		if t, err = newTracking(context.Background(), opts, mode, cache.StringsOption(config, "tracking_prefixes")); err == nil {
+			opts.OnConnect = t.onConnect
 		}
+	default:
+		return nil, fmt.Errorf(`cache: unsupported redis tracking mode: %s`, mode)
+	}
 
-		if inst.previous != nil {
-			keys := strings.Split(data, ",")
-			_ = inst.previous.Del(keys...)
+	cmd := redis.NewUniversalClient(opts)
+	if _, err := cmd.Ping(context.Background()).Result(); err != nil {
+		if t != nil {
+			t.close()
 		}
-	})
+		return nil, err
+	}
+	nodeID, _ := config["node_id"].(string)
+	if nodeID == "" {
+		nodeID = newNodeID()
+	}
+	inst := &redisCache{
+		opts:        opts,
+		load:        cache.ParseLoadOptions(config),
+		codec:       codec,
+		nodeID:      nodeID,
+		tracking:    t,
+		onReconnect: onReconnect,
+		log:         log,
+	}
+	inst.rdb.Store(cmd)
+	// write_back 为 true 时异步写入下一级
+	if opts := cache.ParseWriteBackOptions(config); opts != nil {
+		inst.writeBack = cache.NewWriteBack(func() cache.Cache { return inst.next }, *opts)
+	}
+	if t != nil {
+		// 数据客户端会被替换，订阅使用单独的客户端
+		subOpts := *opts
+		subOpts.OnConnect = nil
+		inst.sub = redis.NewUniversalClient(&subOpts)
+		t.listen(func(keys []string) {
+			if !inst.last() {
+				return
+			}
+			inv := cache.NewInvalidation("", cache.InvalidationDel, keys...)
+			if keys == nil {
+				inv.Prefixes = []string{""}
+			}
+			_ = cache.Invalidate(context.Background(), inst, inv)
+		}, inst.resetTracking, inst.client)
+	}
+	// 默认模式下本节点写入的 key 不会被跟踪，仍需订阅 CONNECT_CHANNEL
+	err = inst.subscribeInvalidations(context.Background())
 	return inst, err
 }
 
-type redisCache struct {
-	rdb      redis.UniversalClient
-	next     cache.Cache
-	previous cache.Cache
+func newNodeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type redisCacheValue struct {
+	ExpiredDuration time.Duration `json:"expired_duration"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Version         int64         `json:"version"`
+	Data            interface{}   `json:"data"`
+	SoftDuration    time.Duration `json:"soft_duration,omitempty"`
+	Delta           time.Duration `json:"delta,omitempty"`
+	Absent          bool          `json:"absent,omitempty"`
+	// Codec Data 的编码方式，为空时视为 JSON；JSON 编码的值直接嵌入，其他编码方式以 base64 字符串保存
+	Codec string `json:"codec,omitempty"`
 }
 
+// parse 解析保存的值并按写入时的编码方式将 Data 解码到 dst，dst 为 nil 时不解码；
+// INCR 等命令写入的计数器没有封装，按没有版本号及过期时间的 JSON 数值解析
+func parse(s string, dst interface{}) (*redisCacheValue, error) {
+	if counter(s) {
+		cv := &redisCacheValue{Data: stdjson.RawMessage(s)}
+		if dst == nil {
+			return cv, nil
+		}
+		return cv, json.STD().Unmarshal([]byte(s), dst)
+	}
+	var data stdjson.RawMessage
+	cv := &redisCacheValue{Data: &data}
+	if err := json.Parse(s, cv); err != nil {
+		return cv, err
+	}
+	if cv.Absent || dst == nil {
+		return cv, nil
+	}
+	if cv.Codec == "" || cv.Codec == cache.CodecJSON {
+		return cv, json.STD().Unmarshal(data, dst)
+	}
+	var raw []byte
+	if err := json.STD().Unmarshal(data, &raw); err != nil {
+		return cv, err
+	}
+	return cv, cache.Decode(cv.Codec, raw, dst)
+}
+
+// counter 判断 s 是否为 INCR、INCRBY 或 INCRBYFLOAT 写入的数值，封装后的值总是以 { 开头
+func counter(s string) bool {
+	if s == "" || s[0] == '{' {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// absent 判断 s 是否为不存在的标记
+func absent(s string) bool {
+	var v struct {
+		Absent bool `json:"absent"`
+	}
+	return json.Parse(s, &v) == nil && v.Absent
+}
+
+func (v *redisCacheValue) meta() *cache.Meta {
+	return &cache.Meta{
+		Version:         v.Version,
+		CreatedAt:       v.CreatedAt,
+		ExpiredDuration: v.ExpiredDuration,
+		SoftDuration:    v.SoftDuration,
+		Delta:           v.Delta,
+	}
+}
+
+func (v *redisCacheValue) ttl() time.Duration {
+	if v.ExpiredDuration <= 0 {
+		return 0
+	}
+	return time.Until(v.CreatedAt.Add(v.ExpiredDuration))
+}
+
+type redisCache struct {
+	// rdb 当前的数据客户端 redis.UniversalClient，开启 CLIENT TRACKING 时会在重定向失效后被替换
+	rdb      atomic.Value
+	opts     *redis.UniversalOptions
+	load     cache.LoadOptions
+	nodeID   string
+	tracking *tracking
+	// 订阅 CONNECT_CHANNEL 的连接及断线重连后的处理策略；sub 不为 nil 时所有订阅使用该客户端
+	sub         redis.UniversalClient
+	pubsub      *redis.PubSub
+	onReconnect string
+	log         *invalidationLog
+	writeBack   *cache.WriteBack
+	codec       cache.Codec
+	policy      cache.Policy
+	next        cache.Cache
+	previous    cache.Cache
+
+	// inner 为 1 时本级有下一级，原子读写
+	inner int32
+}
+
+// SetNext 本级不是最后一级时不再处理失效消息，避免同一条消息被多个 Redis 层级重复处理
 func (r *redisCache) SetNext(next cache.Cache) {
 	r.next = next
+	if next != nil && atomic.CompareAndSwapInt32(&r.inner, 0, 1) && r.pubsub != nil {
+		_ = r.pubsub.Close()
+	}
+}
+
+// client 返回当前的数据客户端
+func (r *redisCache) client() redis.UniversalClient {
+	return r.rdb.Load().(redis.UniversalClient)
+}
+
+// subscriber 返回订阅使用的客户端，订阅不能使用会被替换的数据客户端
+func (r *redisCache) subscriber() redis.UniversalClient {
+	if r.sub != nil {
+		return r.sub
+	}
+	return r.client()
+}
+
+// resetTracking 订阅 __redis__:invalidate 的连接重连后连接 ID 已变化，已有的数据连接仍重定向到旧的 ID，
+// 替换数据客户端使新建的连接按新的 ID 开启 CLIENT TRACKING；期间的失效消息已丢失，清空上一级及之前各级的本地缓存
+func (r *redisCache) resetTracking() {
+	old := r.client()
+	r.rdb.Store(redis.NewUniversalClient(r.opts))
+	// 延迟关闭旧的客户端，等待正在执行的命令完成
+	time.AfterFunc(recycleDelay, func() { _ = old.Close() })
+	if r.last() {
+		_ = cache.Invalidate(context.Background(), r, &cache.Invalidation{Op: cache.InvalidationDel, Prefixes: []string{""}})
+	}
+}
+
+// last 本级是否为最后一级，只有最后一级广播及处理失效消息
+func (r *redisCache) last() bool {
+	return atomic.LoadInt32(&r.inner) == 0
+}
+
+func (r *redisCache) SetPolicy(policy cache.Policy) {
+	r.policy = policy
 }
 
 func (r *redisCache) SetPrevious(previous cache.Cache) {
@@ -62,14 +256,28 @@ func (r *redisCache) SetPrevious(previous cache.Cache) {
 }
 
 func (r *redisCache) Publish(channel string, message interface{}) error {
-	return r.rdb.Publish(context.Background(), channel, message).Err()
+	return r.PublishCtx(context.Background(), channel, message)
+}
+
+func (r *redisCache) PublishCtx(ctx context.Context, channel string, message interface{}) error {
+	return r.client().Publish(ctx, channel, message).Err()
 }
 
 func (r *redisCache) Subscribe(channels []string, handler func(string, string)) error {
-	ps := r.rdb.Subscribe(context.Background(), channels...)
-	if _, err := ps.Receive(context.Background()); err != nil {
+	return r.SubscribeCtx(context.Background(), channels, handler)
+}
+
+func (r *redisCache) SubscribeCtx(ctx context.Context, channels []string, handler func(string, string)) error {
+	ps := r.subscriber().Subscribe(ctx, channels...)
+	if _, err := ps.Receive(ctx); err != nil {
 		return err
 	}
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			_ = ps.Close()
+		}()
+	}
 	ch := ps.Channel()
 	go func(ch <-chan *redis.Message) {
 		for msg := range ch {
@@ -80,10 +288,20 @@ func (r *redisCache) Subscribe(channels []string, handler func(string, string))
 }
 
 func (r *redisCache) PSubscribe(patterns []string, handler func(string, string)) error {
-	pubsub := r.rdb.PSubscribe(context.Background(), patterns...)
-	if _, err := pubsub.Receive(context.Background()); err != nil {
+	return r.PSubscribeCtx(context.Background(), patterns, handler)
+}
+
+func (r *redisCache) PSubscribeCtx(ctx context.Context, patterns []string, handler func(string, string)) error {
+	pubsub := r.subscriber().PSubscribe(ctx, patterns...)
+	if _, err := pubsub.Receive(ctx); err != nil {
 		return err
 	}
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			_ = pubsub.Close()
+		}()
+	}
 	ch := pubsub.Channel()
 	go func(ch <-chan *redis.Message) {
 		for msg := range ch {
@@ -94,386 +312,579 @@ func (r *redisCache) PSubscribe(patterns []string, handler func(string, string))
 }
 
 func (r *redisCache) TTL(path string) (time.Duration, bool) {
-	dur, err := r.rdb.TTL(context.Background(), path).Result()
-	return dur, err == nil
+	return r.TTLCtx(context.Background(), path)
+}
+
+func (r *redisCache) TTLCtx(ctx context.Context, path string) (time.Duration, bool) {
+	dur, err := r.client().TTL(ctx, path).Result()
+	if err != nil || dur == -2 {
+		return 0, false
+	}
+	if dur < 0 {
+		// 未设置过期时间
+		return 0, true
+	}
+	return dur, true
 }
 
 func (r *redisCache) Has(key string) bool {
-	has := r.rdb.Exists(context.Background(), key).Val() > 1
-	if !has && r.next != nil {
-		has = r.next.Has(key)
+	return r.HasCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasCtx(ctx context.Context, key string) bool {
+	s, err := r.client().Get(ctx, key).Result()
+	if err == nil {
+		return !absent(s)
 	}
-	return has
+	if r.next != nil {
+		return r.next.HasCtx(ctx, key)
+	}
+	return false
 }
 
 func (r *redisCache) HasGet(key string, dst interface{}) bool {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if has && s != "" {
-		var v struct {
-			ExpiredDuration int64       `json:"expired_duration"`
-			CreatedAt       time.Time   `json:"created_at"`
-			Data            interface{} `json:"data"`
-		}
-		if err = json.Parse(s, &v); err == nil {
-			err = json.Copy(v.Data, dst)
-		}
-	} else if r.next != nil {
-		has = r.next.HasGet(key, dst)
-		var ttl time.Duration
-		ttl, has = r.next.TTL(key)
-		if has {
-			_ = r.Set(key, dst, ttl)
+	return r.HasGetCtx(context.Background(), key, dst)
+}
+
+// hasGet 读取本级保存的值并解码到 dst，本级没有该 key 或无法解码时返回 nil
+func (r *redisCache) hasGet(ctx context.Context, key string, dst interface{}) (*redisCacheValue, bool) {
+	s, err := r.client().Get(ctx, key).Result()
+	if err != nil {
+		return nil, false
+	}
+	cv, err := parse(s, dst)
+	if err != nil {
+		// 无法解码到 dst 时视为本级未命中，继续读取下一级
+		return nil, false
+	}
+	if cv.Absent {
+		return cv, false
+	}
+	r.revalidate(key, cv.CreatedAt, cv.ExpiredDuration, cv.SoftDuration)
+	return cv, true
+}
+
+func (r *redisCache) HasGetCtx(ctx context.Context, key string, dst interface{}) bool {
+	cv, has := r.hasGet(ctx, key, dst)
+	if cv == nil && r.next != nil {
+		if has = r.next.HasGetCtx(ctx, key, dst); has {
+			if ttl, ok := r.next.TTLCtx(ctx, key); ok {
+				r.backfill(ctx, key, dst, ttl)
+			}
 		}
 	}
 	return has
 }
 
 func (r *redisCache) HasGetInt(key string) (int, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.next != nil {
-		var v int
-		v, has = r.next.HasGetInt(key)
-		var ttl time.Duration
-		ttl, has = r.next.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            int       `json:"data"`
+	return r.HasGetIntCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetIntCtx(ctx context.Context, key string) (int, bool) {
+	var v int
+	cv, has := r.hasGet(ctx, key, &v)
+	if cv == nil && r.next != nil {
+		if v, has = r.next.HasGetIntCtx(ctx, key); has {
+			if ttl, ok := r.next.TTLCtx(ctx, key); ok {
+				r.backfill(ctx, key, v, ttl)
+			}
+		}
 	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	return v, has
 }
 
 func (r *redisCache) HasGetInt8(key string) (int8, bool) {
-	v, has := r.HasGetInt(key)
+	return r.HasGetInt8Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetInt8Ctx(ctx context.Context, key string) (int8, bool) {
+	v, has := r.HasGetIntCtx(ctx, key)
 	return int8(v), has
 }
 
 func (r *redisCache) HasGetInt16(key string) (int16, bool) {
-	v, has := r.HasGetInt(key)
+	return r.HasGetInt16Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetInt16Ctx(ctx context.Context, key string) (int16, bool) {
+	v, has := r.HasGetIntCtx(ctx, key)
 	return int16(v), has
 }
 
 func (r *redisCache) HasGetInt32(key string) (int32, bool) {
-	v, has := r.HasGetInt(key)
+	return r.HasGetInt32Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetInt32Ctx(ctx context.Context, key string) (int32, bool) {
+	v, has := r.HasGetIntCtx(ctx, key)
 	return int32(v), has
 }
 
 func (r *redisCache) HasGetInt64(key string) (int64, bool) {
-	v, has := r.HasGetInt(key)
+	return r.HasGetInt64Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetInt64Ctx(ctx context.Context, key string) (int64, bool) {
+	v, has := r.HasGetIntCtx(ctx, key)
 	return int64(v), has
 }
 
 func (r *redisCache) HasGetUint(key string) (uint, bool) {
-	v, has := r.HasGetUint64(key)
+	return r.HasGetUintCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetUintCtx(ctx context.Context, key string) (uint, bool) {
+	v, has := r.HasGetUint64Ctx(ctx, key)
 	return uint(v), has
 }
 
 func (r *redisCache) HasGetUint8(key string) (uint8, bool) {
-	v, has := r.HasGetUint64(key)
+	return r.HasGetUint8Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetUint8Ctx(ctx context.Context, key string) (uint8, bool) {
+	v, has := r.HasGetUint64Ctx(ctx, key)
 	return uint8(v), has
 }
 
 func (r *redisCache) HasGetUint16(key string) (uint16, bool) {
-	v, has := r.HasGetUint64(key)
+	return r.HasGetUint16Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetUint16Ctx(ctx context.Context, key string) (uint16, bool) {
+	v, has := r.HasGetUint64Ctx(ctx, key)
 	return uint16(v), has
 }
 
 func (r *redisCache) HasGetUint32(key string) (uint32, bool) {
-	v, has := r.HasGetUint64(key)
+	return r.HasGetUint32Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetUint32Ctx(ctx context.Context, key string) (uint32, bool) {
+	v, has := r.HasGetUint64Ctx(ctx, key)
 	return uint32(v), has
 }
 
 func (r *redisCache) HasGetUint64(key string) (uint64, bool) {
-	v, has := r.HasGetInt(key)
+	return r.HasGetUint64Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetUint64Ctx(ctx context.Context, key string) (uint64, bool) {
+	v, has := r.HasGetIntCtx(ctx, key)
 	return uint64(v), has
 }
 
 func (r *redisCache) HasGetFloat(key string) (float64, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.next != nil {
-		var v float64
-		v, has = r.next.HasGetFloat(key)
-		var ttl time.Duration
-		ttl, has = r.next.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            float64   `json:"data"`
+	return r.HasGetFloatCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetFloatCtx(ctx context.Context, key string) (float64, bool) {
+	var v float64
+	cv, has := r.hasGet(ctx, key, &v)
+	if cv == nil && r.next != nil {
+		if v, has = r.next.HasGetFloatCtx(ctx, key); has {
+			if ttl, ok := r.next.TTLCtx(ctx, key); ok {
+				r.backfill(ctx, key, v, ttl)
+			}
+		}
 	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	return v, has
 }
 
 func (r *redisCache) HasGetFloat32(key string) (float32, bool) {
-	v, has := r.HasGetFloat(key)
+	return r.HasGetFloat32Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetFloat32Ctx(ctx context.Context, key string) (float32, bool) {
+	v, has := r.HasGetFloatCtx(ctx, key)
 	return float32(v), has
 }
 
 func (r *redisCache) HasGetFloat64(key string) (float64, bool) {
-	return r.HasGetFloat(key)
+	return r.HasGetFloat64Ctx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetFloat64Ctx(ctx context.Context, key string) (float64, bool) {
+	return r.HasGetFloatCtx(ctx, key)
 }
 
 func (r *redisCache) HasGetString(key string) (string, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.next != nil {
-		var v string
-		v, has = r.next.HasGetString(key)
-		var ttl time.Duration
-		ttl, has = r.next.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
+	return r.HasGetStringCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetStringCtx(ctx context.Context, key string) (string, bool) {
+	var v string
+	cv, has := r.hasGet(ctx, key, &v)
+	if cv == nil && r.next != nil {
+		if v, has = r.next.HasGetStringCtx(ctx, key); has {
+			if ttl, ok := r.next.TTLCtx(ctx, key); ok {
+				r.backfill(ctx, key, v, ttl)
+			}
 		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            string    `json:"data"`
 	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	return v, has
 }
 
 func (r *redisCache) HasGetBool(key string) (bool, bool) {
-	s, err := r.rdb.Get(context.Background(), key).Result()
-	has := err == nil
-	if !has && r.next != nil {
-		var v bool
-		v, has = r.next.HasGetBool(key)
-		var ttl time.Duration
-		ttl, has = r.next.TTL(key)
-		if has {
-			_ = r.Set(key, v, ttl)
-		}
-		return v, has
-	}
-	var v struct {
-		ExpiredDuration int64     `json:"expired_duration"`
-		CreatedAt       time.Time `json:"created_at"`
-		Data            bool      `json:"data"`
+	return r.HasGetBoolCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetBoolCtx(ctx context.Context, key string) (bool, bool) {
+	var v bool
+	cv, has := r.hasGet(ctx, key, &v)
+	if cv == nil && r.next != nil {
+		if v, has = r.next.HasGetBoolCtx(ctx, key); has {
+			if ttl, ok := r.next.TTLCtx(ctx, key); ok {
+				r.backfill(ctx, key, v, ttl)
+			}
+		}
 	}
-	err = json.Parse(s, &v)
-	return v.Data, has
+	return v, has
 }
 
 func (r *redisCache) HasGetTime(key string) (time.Time, bool) {
+	return r.HasGetTimeCtx(context.Background(), key)
+}
+
+func (r *redisCache) HasGetTimeCtx(ctx context.Context, key string) (time.Time, bool) {
 	var v time.Time
-	has := r.HasGet(key, &v)
+	has := r.HasGetCtx(ctx, key, &v)
 	return v, has
 }
 
 func (r *redisCache) Get(key string, dst interface{}) {
-	_ = r.HasGet(key, dst)
+	r.GetCtx(context.Background(), key, dst)
+}
+
+func (r *redisCache) GetCtx(ctx context.Context, key string, dst interface{}) {
+	_ = r.HasGetCtx(ctx, key, dst)
 }
 
 func (r *redisCache) GetInt(key string) int {
-	v, _ := r.HasGetInt(key)
+	return r.GetIntCtx(context.Background(), key)
+}
+
+func (r *redisCache) GetIntCtx(ctx context.Context, key string) int {
+	v, _ := r.HasGetIntCtx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetInt8(key string) int8 {
-	v, _ := r.HasGetInt8(key)
+	return r.GetInt8Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetInt8Ctx(ctx context.Context, key string) int8 {
+	v, _ := r.HasGetInt8Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetInt16(key string) int16 {
-	v, _ := r.HasGetInt16(key)
+	return r.GetInt16Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetInt16Ctx(ctx context.Context, key string) int16 {
+	v, _ := r.HasGetInt16Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetInt32(key string) int32 {
-	v, _ := r.HasGetInt32(key)
+	return r.GetInt32Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetInt32Ctx(ctx context.Context, key string) int32 {
+	v, _ := r.HasGetInt32Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetInt64(key string) int64 {
-	v, _ := r.HasGetInt64(key)
+	return r.GetInt64Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetInt64Ctx(ctx context.Context, key string) int64 {
+	v, _ := r.HasGetInt64Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetUint(key string) uint {
-	v, _ := r.HasGetUint(key)
+	return r.GetUintCtx(context.Background(), key)
+}
+
+func (r *redisCache) GetUintCtx(ctx context.Context, key string) uint {
+	v, _ := r.HasGetUintCtx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetUint8(key string) uint8 {
-	v, _ := r.HasGetUint8(key)
+	return r.GetUint8Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetUint8Ctx(ctx context.Context, key string) uint8 {
+	v, _ := r.HasGetUint8Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetUint16(key string) uint16 {
-	v, _ := r.HasGetUint16(key)
+	return r.GetUint16Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetUint16Ctx(ctx context.Context, key string) uint16 {
+	v, _ := r.HasGetUint16Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetUint32(key string) uint32 {
-	v, _ := r.HasGetUint32(key)
+	return r.GetUint32Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetUint32Ctx(ctx context.Context, key string) uint32 {
+	v, _ := r.HasGetUint32Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetUint64(key string) uint64 {
-	v, _ := r.HasGetUint64(key)
+	return r.GetUint64Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetUint64Ctx(ctx context.Context, key string) uint64 {
+	v, _ := r.HasGetUint64Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetFloat(key string) float64 {
-	v, _ := r.HasGetFloat(key)
+	return r.GetFloatCtx(context.Background(), key)
+}
+
+func (r *redisCache) GetFloatCtx(ctx context.Context, key string) float64 {
+	v, _ := r.HasGetFloatCtx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetFloat32(key string) float32 {
-	v, _ := r.HasGetFloat32(key)
+	return r.GetFloat32Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetFloat32Ctx(ctx context.Context, key string) float32 {
+	v, _ := r.HasGetFloat32Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetFloat64(key string) float64 {
-	v, _ := r.HasGetFloat64(key)
+	return r.GetFloat64Ctx(context.Background(), key)
+}
+
+func (r *redisCache) GetFloat64Ctx(ctx context.Context, key string) float64 {
+	v, _ := r.HasGetFloat64Ctx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetString(key string) string {
-	v, _ := r.HasGetString(key)
+	return r.GetStringCtx(context.Background(), key)
+}
+
+func (r *redisCache) GetStringCtx(ctx context.Context, key string) string {
+	v, _ := r.HasGetStringCtx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetBool(key string) bool {
-	v, _ := r.HasGetBool(key)
+	return r.GetBoolCtx(context.Background(), key)
+}
+
+func (r *redisCache) GetBoolCtx(ctx context.Context, key string) bool {
+	v, _ := r.HasGetBoolCtx(ctx, key)
 	return v
 }
 
 func (r *redisCache) GetTime(key string) time.Time {
-	v, _ := r.HasGetTime(key)
+	return r.GetTimeCtx(context.Background(), key)
+}
+
+func (r *redisCache) GetTimeCtx(ctx context.Context, key string) time.Time {
+	v, _ := r.HasGetTimeCtx(ctx, key)
 	return v
 }
 
 func (r *redisCache) DefaultGet(key string, dst interface{}, defaultValue interface{}) {
-	if !r.HasGet(key, dst) {
+	r.DefaultGetCtx(context.Background(), key, dst, defaultValue)
+}
+
+func (r *redisCache) DefaultGetCtx(ctx context.Context, key string, dst interface{}, defaultValue interface{}) {
+	if !r.HasGetCtx(ctx, key, dst) {
 		_ = json.Copy(defaultValue, dst)
 	}
 }
 
 func (r *redisCache) DefaultGetInt(key string, defaultValue int) int {
-	if v, has := r.HasGetInt(key); has {
+	return r.DefaultGetIntCtx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetIntCtx(ctx context.Context, key string, defaultValue int) int {
+	if v, has := r.HasGetIntCtx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetInt8(key string, defaultValue int8) int8 {
-	if v, has := r.HasGetInt8(key); has {
+	return r.DefaultGetInt8Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetInt8Ctx(ctx context.Context, key string, defaultValue int8) int8 {
+	if v, has := r.HasGetInt8Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetInt16(key string, defaultValue int16) int16 {
-	if v, has := r.HasGetInt16(key); has {
+	return r.DefaultGetInt16Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetInt16Ctx(ctx context.Context, key string, defaultValue int16) int16 {
+	if v, has := r.HasGetInt16Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetInt32(key string, defaultValue int32) int32 {
-	if v, has := r.HasGetInt32(key); has {
+	return r.DefaultGetInt32Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetInt32Ctx(ctx context.Context, key string, defaultValue int32) int32 {
+	if v, has := r.HasGetInt32Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetInt64(key string, defaultValue int64) int64 {
-	if v, has := r.HasGetInt64(key); has {
+	return r.DefaultGetInt64Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetInt64Ctx(ctx context.Context, key string, defaultValue int64) int64 {
+	if v, has := r.HasGetInt64Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetUint(key string, defaultValue uint) uint {
-	if v, has := r.HasGetUint(key); has {
+	return r.DefaultGetUintCtx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetUintCtx(ctx context.Context, key string, defaultValue uint) uint {
+	if v, has := r.HasGetUintCtx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetUint8(key string, defaultValue uint8) uint8 {
-	if v, has := r.HasGetUint8(key); has {
+	return r.DefaultGetUint8Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetUint8Ctx(ctx context.Context, key string, defaultValue uint8) uint8 {
+	if v, has := r.HasGetUint8Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetUint16(key string, defaultValue uint16) uint16 {
-	if v, has := r.HasGetUint16(key); has {
+	return r.DefaultGetUint16Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetUint16Ctx(ctx context.Context, key string, defaultValue uint16) uint16 {
+	if v, has := r.HasGetUint16Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetUint32(key string, defaultValue uint32) uint32 {
-	if v, has := r.HasGetUint32(key); has {
+	return r.DefaultGetUint32Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetUint32Ctx(ctx context.Context, key string, defaultValue uint32) uint32 {
+	if v, has := r.HasGetUint32Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetUint64(key string, defaultValue uint64) uint64 {
-	if v, has := r.HasGetUint64(key); has {
+	return r.DefaultGetUint64Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetUint64Ctx(ctx context.Context, key string, defaultValue uint64) uint64 {
+	if v, has := r.HasGetUint64Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetFloat(key string, defaultValue float64) float64 {
-	if v, has := r.HasGetFloat(key); has {
+	return r.DefaultGetFloatCtx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetFloatCtx(ctx context.Context, key string, defaultValue float64) float64 {
+	if v, has := r.HasGetFloatCtx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetFloat32(key string, defaultValue float32) float32 {
-	if v, has := r.HasGetFloat32(key); has {
+	return r.DefaultGetFloat32Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetFloat32Ctx(ctx context.Context, key string, defaultValue float32) float32 {
+	if v, has := r.HasGetFloat32Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetFloat64(key string, defaultValue float64) float64 {
-	if v, has := r.HasGetFloat64(key); has {
+	return r.DefaultGetFloat64Ctx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetFloat64Ctx(ctx context.Context, key string, defaultValue float64) float64 {
+	if v, has := r.HasGetFloat64Ctx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetString(key string, defaultValue string) string {
-	if v, has := r.HasGetString(key); has {
+	return r.DefaultGetStringCtx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetStringCtx(ctx context.Context, key string, defaultValue string) string {
+	if v, has := r.HasGetStringCtx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetBool(key string, defaultValue bool) bool {
-	if v, has := r.HasGetBool(key); has {
+	return r.DefaultGetBoolCtx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetBoolCtx(ctx context.Context, key string, defaultValue bool) bool {
+	if v, has := r.HasGetBoolCtx(ctx, key); has {
 		return v
 	}
 	return defaultValue
 }
 
 func (r *redisCache) DefaultGetTime(key string, defaultValue time.Time) time.Time {
-	if v, has := r.HasGetTime(key); has {
+	return r.DefaultGetTimeCtx(context.Background(), key, defaultValue)
+}
+
+func (r *redisCache) DefaultGetTimeCtx(ctx context.Context, key string, defaultValue time.Time) time.Time {
+	if v, has := r.HasGetTimeCtx(ctx, key); has {
 		return v
 	}
 	return defaultValue
@@ -488,107 +899,776 @@ func (r *redisCache) Previous() cache.Cache {
 }
 
 func (r *redisCache) HasPrefix(s string, limit ...int) (map[string]string, error) {
-	v, err := r.contains(fmt.Sprintf("%s*", s), limit...)
+	return r.HasPrefixCtx(context.Background(), s, limit...)
+}
+
+func (r *redisCache) HasPrefixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	v, err := r.contains(ctx, fmt.Sprintf("%s*", s), limit...)
 
 	if err == nil && len(v) == 0 && r.next != nil {
-		return r.next.HasPrefix(s, limit...)
+		return r.next.HasPrefixCtx(ctx, s, limit...)
 	}
 
 	return v, err
 }
 
 func (r *redisCache) HasSuffix(s string, limit ...int) (map[string]string, error) {
-	v, err := r.contains(fmt.Sprintf("*%s", s), limit...)
+	return r.HasSuffixCtx(context.Background(), s, limit...)
+}
+
+func (r *redisCache) HasSuffixCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	v, err := r.contains(ctx, fmt.Sprintf("*%s", s), limit...)
 
 	if err == nil && len(v) == 0 && r.next != nil {
-		return r.next.HasSuffix(s, limit...)
+		return r.next.HasSuffixCtx(ctx, s, limit...)
 	}
 
 	return v, err
 }
 
 func (r *redisCache) Contains(s string, limit ...int) (map[string]string, error) {
-	v, err := r.contains(fmt.Sprintf("*%s*", s), limit...)
+	return r.ContainsCtx(context.Background(), s, limit...)
+}
+
+func (r *redisCache) ContainsCtx(ctx context.Context, s string, limit ...int) (map[string]string, error) {
+	v, err := r.contains(ctx, fmt.Sprintf("*%s*", s), limit...)
 
 	if err == nil && len(v) == 0 && r.next != nil {
-		return r.next.Contains(s, limit...)
+		return r.next.ContainsCtx(ctx, s, limit...)
 	}
 
 	return v, err
 }
 
 func (r *redisCache) Set(key string, value interface{}, expiration ...time.Duration) error {
-	var dur time.Duration
+	return r.SetCtx(context.Background(), key, value, expiration...)
+}
+
+func (r *redisCache) SetCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) error {
+	var opts cache.SetOptions
 	if len(expiration) > 0 {
-		dur = expiration[0]
+		opts.Expiration = expiration[0]
+	}
+	return r.SetWithOptionsCtx(ctx, key, value, opts)
+}
+
+func (r *redisCache) SetWithOptions(key string, value interface{}, opts cache.SetOptions) error {
+	return r.SetWithOptionsCtx(context.Background(), key, value, opts)
+}
+
+func (r *redisCache) SetWithOptionsCtx(ctx context.Context, key string, value interface{}, opts cache.SetOptions) error {
+	var err error
+	if r.policy.Stores(r.next != nil) {
+		ttl := r.policy.TTL(opts.Expiration)
+		var v string
+		if v, err = r.marshal(value, ttl, opts, r.version()); err != nil {
+			return err
+		}
+		err = r.client().Set(ctx, key, v, ttl).Err()
+	} else if !r.policy.ReadOnly {
+		// 写绕过时删除本级的旧值
+		err = r.del(ctx, key)
+	}
+	if err == nil && r.next != nil {
+		if r.writeBack != nil {
+			err = r.writeBack.Set(ctx, key, value, opts)
+		} else {
+			err = r.next.SetWithOptionsCtx(ctx, key, value, opts)
+		}
+	} else if err == nil && !r.policy.ReadOnly {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
+	return err
+}
+
+// version 返回本级写入的版本号；版本号以最后一级为准，之前的层级写入时记为 0，HasGetMeta 读到 0 时读取下一级
+func (r *redisCache) version() int64 {
+	if r.next != nil {
+		return 0
+	}
+	return cache.NewVersion(0)
+}
+
+// backfill 将下一级命中的值写入本级，不再传递给下一级
+func (r *redisCache) backfill(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	if r.policy.Populate() {
+		ttl = r.policy.TTL(ttl)
+		if v, err := r.marshal(value, ttl, cache.SetOptions{}, 0); err == nil {
+			_ = r.client().Set(ctx, key, v, ttl).Err()
+		}
+	}
+}
+
+// backfillMeta 将下一级命中的值连同版本号及重新计算的耗时写入本级
+func (r *redisCache) backfillMeta(ctx context.Context, key string, value interface{}, meta *cache.Meta) {
+	ttl := meta.TTL()
+	if !r.policy.Populate() || (meta.ExpiredDuration > 0 && ttl <= 0) {
+		return
+	}
+	ttl = r.policy.TTL(ttl)
+	if v, err := r.marshal(value, ttl, cache.SetOptions{Delta: meta.Delta}, meta.Version); err == nil {
+		_ = r.client().Set(ctx, key, v, ttl).Err()
+	}
+}
+
+// revalidate 读到的值超过软过期时间时在后台刷新
+func (r *redisCache) revalidate(key string, createdAt time.Time, exp, soft time.Duration) {
+	if soft > 0 {
+		cache.Revalidate(r, key, &cache.Meta{CreatedAt: createdAt, ExpiredDuration: exp, SoftDuration: soft})
+	}
+}
+
+// invalidate 由最后一级向其他节点广播失效的 key
+func (r *redisCache) invalidate(ctx context.Context, op cache.InvalidationOp, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.broadcast(ctx, cache.NewInvalidation(r.nodeID, op, keys...))
+}
+
+func (r *redisCache) broadcast(ctx context.Context, inv *cache.Invalidation) error {
+	if r.next != nil {
+		return nil
+	}
+	if r.log != nil {
+		// 写入日志与广播在同一个脚本中完成，广播的消息带有日志中的序号
+		seq, err := broadcastScript.Run(ctx, r.client(), []string{r.log.key}, r.log.maxLen, inv.String(), connectChannel).Text()
+		if err != nil {
+			return err
+		}
+		inv.Seq = seq
+		return nil
 	}
-	cv := struct {
-		ExpiredDuration time.Duration `json:"expired_duration"`
-		CreatedAt       time.Time     `json:"created_at"`
-		Data            interface{}   `json:"data"`
-	}{
+	return r.PublishCtx(ctx, connectChannel, inv.String())
+}
+
+// broadcastScript 将 ARGV[2] 写入失效日志 KEYS[1]（近似保留 ARGV[1] 条），再把带有序号的消息发布到 ARGV[3]；
+// ARGV[2] 为不含 seq 字段的 JSON 对象
+var broadcastScript = redis.NewScript(`
+local seq = redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], '*', 'msg', ARGV[2])
+redis.call('PUBLISH', ARGV[3], string.sub(ARGV[2], 1, -2) .. ',"seq":"' .. seq .. '"}')
+return seq
+`)
+
+// marshal 编码本级保存的值，并记录 opts 中的软过期时间及重新计算的耗时
+func (r *redisCache) marshal(value interface{}, dur time.Duration, opts cache.SetOptions, version int64) (string, error) {
+	codec, raw, err := cache.Encode(r.codec, value)
+	if err != nil {
+		return "", err
+	}
+	cv := redisCacheValue{
 		ExpiredDuration: dur,
 		CreatedAt:       time.Now(),
-		Data:            value,
+		Version:         version,
+		Data:            raw,
+		SoftDuration:    opts.SoftTTL,
+		Delta:           opts.Delta,
+		Codec:           codec,
+	}
+	if codec == cache.CodecJSON {
+		cv.Data = stdjson.RawMessage(raw)
+	}
+	data, err := json.STD().Marshal(&cv)
+	return string(data), err
+}
+
+func (r *redisCache) MGet(dst map[string]interface{}) (map[string]time.Duration, error) {
+	return r.MGetCtx(context.Background(), dst)
+}
+
+func (r *redisCache) MGetCtx(ctx context.Context, dst map[string]interface{}) (map[string]time.Duration, error) {
+	var (
+		keys  = make([]string, 0, len(dst))
+		found = make(map[string]time.Duration)
+	)
+	for key := range dst {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return found, nil
+	}
+	vals, err := r.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make(map[string]interface{})
+	for i, key := range keys {
+		s, ok := vals[i].(string)
+		if !ok {
+			missing[key] = dst[key]
+			continue
+		}
+		cv, err := parse(s, dst[key])
+		if err != nil {
+			// 无法解码到 dst 时视为本级未命中
+			missing[key] = dst[key]
+			continue
+		}
+		// 不存在的标记既不命中也不查询下一级
+		if cv.Absent {
+			continue
+		}
+		r.revalidate(key, cv.CreatedAt, cv.ExpiredDuration, cv.SoftDuration)
+		found[key] = cv.ttl()
+	}
+	if len(missing) == 0 || r.next == nil {
+		return found, nil
+	}
+
+	nextFound, err := r.next.MGetCtx(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	// 仅回填下一级命中的 key
+	pipe := r.client().Pipeline()
+	for key, ttl := range nextFound {
+		found[key] = ttl
+		ttl = r.policy.TTL(ttl)
+		if v, err := r.marshal(missing[key], ttl, cache.SetOptions{}, 0); err == nil {
+			pipe.Set(ctx, key, v, ttl)
+		}
+	}
+	if len(nextFound) > 0 && r.policy.Populate() {
+		_, _ = pipe.Exec(ctx)
+	}
+	return found, nil
+}
+
+func (r *redisCache) mget(ctx context.Context, keys []string) ([]interface{}, error) {
+	if _, ok := r.client().(*redis.ClusterClient); !ok {
+		return r.client().MGet(ctx, keys...).Result()
+	}
+	// 集群模式下 MGET 不支持跨槽位，改用管道
+	cmds := make([]*redis.StringCmd, len(keys))
+	pipe := r.client().Pipeline()
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	vals := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		if s, err := cmd.Result(); err == nil {
+			vals[i] = s
+		}
+	}
+	return vals, nil
+}
+
+func (r *redisCache) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	return r.MSetCtx(context.Background(), values, expiration...)
+}
+
+func (r *redisCache) MSetCtx(ctx context.Context, values map[string]interface{}, expiration ...time.Duration) error {
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	var (
+		err  error
+		keys = make([]string, 0, len(values))
+	)
+	for key := range values {
+		keys = append(keys, key)
+	}
+	if r.policy.Stores(r.next != nil) {
+		pipe := r.client().Pipeline()
+		for key, value := range values {
+			ttl := r.policy.TTL(dur)
+			v, err := r.marshal(value, ttl, cache.SetOptions{}, r.version())
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, key, v, ttl)
+		}
+		if len(values) > 0 {
+			_, err = pipe.Exec(ctx)
+		}
+	} else if !r.policy.ReadOnly {
+		err = r.del(ctx, keys...)
 	}
-	v := json.Stringify(&cv, false)
-	err := r.rdb.Set(context.Background(), key, v, dur).Err()
 	if err == nil && r.next != nil {
-		err = r.next.Set(key, value, expiration...)
+		if r.writeBack != nil {
+			err = r.writeBack.MSet(ctx, values, expiration...)
+		} else {
+			err = r.next.MSetCtx(ctx, values, expiration...)
+		}
+	} else if err == nil && !r.policy.ReadOnly {
+		err = r.invalidate(ctx, cache.InvalidationSet, keys...)
 	}
 	return err
 }
 
 func (r *redisCache) Incr(key string) (int, error) {
+	return r.IncrCtx(context.Background(), key)
+}
+
+func (r *redisCache) IncrCtx(ctx context.Context, key string) (int, error) {
 	if r.next != nil {
-		return r.next.Incr(key)
+		if err := r.flush(ctx, key); err != nil {
+			return 0, err
+		}
+		return r.next.IncrCtx(ctx, key)
 	}
 
-	v, err := r.rdb.Incr(context.Background(), key).Result()
+	if r.policy.ReadOnly {
+		return 0, cache.ErrReadOnly
+	}
+	v, err := r.client().Incr(ctx, key).Result()
+	if err == nil {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
 	return int(v), err
 }
 
 func (r *redisCache) IncrBy(key string, step int) (int, error) {
+	return r.IncrByCtx(context.Background(), key, step)
+}
+
+func (r *redisCache) IncrByCtx(ctx context.Context, key string, step int) (int, error) {
 	if r.next != nil {
-		return r.next.IncrBy(key, step)
+		if err := r.flush(ctx, key); err != nil {
+			return 0, err
+		}
+		return r.next.IncrByCtx(ctx, key, step)
 	}
 
-	v, err := r.rdb.IncrBy(context.Background(), key, int64(step)).Result()
+	if r.policy.ReadOnly {
+		return 0, cache.ErrReadOnly
+	}
+	v, err := r.client().IncrBy(ctx, key, int64(step)).Result()
+	if err == nil {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
 	return int(v), err
 }
 
 func (r *redisCache) IncrByFloat(key string, step float64) (float64, error) {
+	return r.IncrByFloatCtx(context.Background(), key, step)
+}
+
+func (r *redisCache) IncrByFloatCtx(ctx context.Context, key string, step float64) (float64, error) {
 	if r.next != nil {
-		return r.next.IncrByFloat(key, step)
+		if err := r.flush(ctx, key); err != nil {
+			return 0, err
+		}
+		return r.next.IncrByFloatCtx(ctx, key, step)
 	}
 
-	return r.rdb.IncrByFloat(context.Background(), key, step).Result()
+	if r.policy.ReadOnly {
+		return 0, cache.ErrReadOnly
+	}
+	v, err := r.client().IncrByFloat(ctx, key, step).Result()
+	if err == nil {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
+	return v, err
 }
 
 func (r *redisCache) Del(keys ...string) error {
-	err := r.rdb.Del(context.Background(), keys...).Err()
+	return r.DelCtx(context.Background(), keys...)
+}
+
+func (r *redisCache) DelCtx(ctx context.Context, keys ...string) error {
+	return r.MDelCtx(ctx, keys...)
+}
+
+func (r *redisCache) MDel(keys ...string) error {
+	return r.MDelCtx(context.Background(), keys...)
+}
+
+func (r *redisCache) MDelCtx(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var err error
+	if !r.policy.ReadOnly {
+		err = r.del(ctx, keys...)
+	}
+
+	// 本级删除失败时仍删除下一级，返回第一个错误
+	var nextErr error
+	if r.writeBack != nil {
+		nextErr = r.writeBack.Del(ctx, keys...)
+	} else if r.next != nil {
+		nextErr = r.next.MDelCtx(ctx, keys...)
+	} else if err == nil && !r.policy.ReadOnly {
+		err = r.invalidate(ctx, cache.InvalidationDel, keys...)
+	}
+	if err == nil {
+		err = nextErr
+	}
+	return err
+}
+
+func (r *redisCache) del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if _, ok := r.client().(*redis.ClusterClient); ok {
+		pipe := r.client().Pipeline()
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	return r.client().Del(ctx, keys...).Err()
+}
+
+func (r *redisCache) Evict(keys ...string) error {
+	return r.EvictCtx(context.Background(), keys...)
+}
 
+func (r *redisCache) EvictCtx(ctx context.Context, keys ...string) error {
+	return r.del(ctx, keys...)
+}
+
+func (r *redisCache) DelPrefix(prefixes ...string) error {
+	return r.DelPrefixCtx(context.Background(), prefixes...)
+}
+
+func (r *redisCache) DelPrefixCtx(ctx context.Context, prefixes ...string) error {
+	if !r.policy.ReadOnly {
+		if err := r.EvictPrefixCtx(ctx, prefixes...); err != nil {
+			return err
+		}
+	}
 	if r.next != nil {
-		err = r.next.Del(keys...)
+		if r.writeBack != nil {
+			if err := r.writeBack.Flush(ctx); err != nil {
+				return err
+			}
+		}
+		return r.next.DelPrefixCtx(ctx, prefixes...)
+	}
+	if r.policy.ReadOnly {
+		return nil
+	}
+	inv := cache.NewInvalidation(r.nodeID, cache.InvalidationDel)
+	inv.Prefixes = prefixes
+	return r.broadcast(ctx, inv)
+}
+
+func (r *redisCache) EvictPrefix(prefixes ...string) error {
+	return r.EvictPrefixCtx(context.Background(), prefixes...)
+}
+
+func (r *redisCache) EvictPrefixCtx(ctx context.Context, prefixes ...string) error {
+	for _, prefix := range prefixes {
+		keys, err := r.scanKeys(ctx, globEscaper.Replace(prefix)+"*")
+		if err != nil {
+			return err
+		}
+		if err := r.del(ctx, keys...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// scanKeys 返回匹配 match 的所有 key，集群模式下遍历每个主节点
+func (r *redisCache) scanKeys(ctx context.Context, match string) ([]string, error) {
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	scan := func(ctx context.Context, c redis.Cmdable) error {
+		iter := c.Scan(ctx, 0, match, 0).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			keys = append(keys, iter.Val())
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+	var err error
+	if cc, ok := r.client().(*redis.ClusterClient); ok {
+		err = cc.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
 	} else {
-		err = r.Publish(connectChannel, strings.Join(keys, ","))
+		err = scan(ctx, r.client())
+	}
+	return keys, err
+}
+
+func (r *redisCache) HasGetMeta(key string, dst interface{}) (*cache.Meta, bool) {
+	return r.HasGetMetaCtx(context.Background(), key, dst)
+}
+
+func (r *redisCache) HasGetMetaCtx(ctx context.Context, key string, dst interface{}) (*cache.Meta, bool) {
+	// 版本号以最后一级为准，本级写入的值没有版本号时读取下一级
+	cv, has := r.hasGet(ctx, key, dst)
+	if has && (r.next == nil || cv.Version != 0) {
+		return cv.meta(), true
+	}
+	if r.next == nil || (cv != nil && cv.Absent) {
+		return nil, false
+	}
+	_ = r.flush(ctx, key)
+	meta, has := r.next.HasGetMetaCtx(ctx, key, dst)
+	if has {
+		r.backfillMeta(ctx, key, dst, meta)
+	}
+	return meta, has
+}
+
+func (r *redisCache) SetIfAbsent(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return r.SetIfAbsentCtx(context.Background(), key, value, expiration...)
+}
+
+func (r *redisCache) SetIfAbsentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	if r.next != nil {
+		if err := r.flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := r.next.SetIfAbsentCtx(ctx, key, value, expiration...)
+		if ok {
+			_ = r.del(ctx, key)
+		}
+		return ok, err
+	}
+	if r.policy.ReadOnly {
+		return false, cache.ErrReadOnly
+	}
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	dur = r.policy.TTL(dur)
+	var px int64
+	if dur > 0 {
+		if px = dur.Milliseconds(); px == 0 {
+			px = 1
+		}
 	}
+	v, err := r.marshal(value, dur, cache.SetOptions{}, cache.NewVersion(0))
+	if err != nil {
+		return false, err
+	}
+	n, err := setIfScript.Run(ctx, r.client(), []string{key}, "nx", v, px).Int()
+	if n == 1 {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
+	return n == 1, err
+}
 
+func (r *redisCache) SetIfPresent(key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	return r.SetIfPresentCtx(context.Background(), key, value, expiration...)
+}
+
+func (r *redisCache) SetIfPresentCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) (bool, error) {
+	if r.next != nil {
+		if err := r.flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := r.next.SetIfPresentCtx(ctx, key, value, expiration...)
+		if ok {
+			_ = r.del(ctx, key)
+		}
+		return ok, err
+	}
+	if r.policy.ReadOnly {
+		return false, cache.ErrReadOnly
+	}
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	dur = r.policy.TTL(dur)
+	var px int64
+	if dur > 0 {
+		if px = dur.Milliseconds(); px == 0 {
+			px = 1
+		}
+	}
+	v, err := r.marshal(value, dur, cache.SetOptions{}, cache.NewVersion(0))
+	if err != nil {
+		return false, err
+	}
+	n, err := setIfScript.Run(ctx, r.client(), []string{key}, "xx", v, px).Int()
+	if n == 1 {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
+	return n == 1, err
+}
+
+// setIfScript ARGV[1] 为 nx 时仅在 key 不存在时写入，为 xx 时仅在 key 存在时写入，不存在的标记视为不存在
+var setIfScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+local present = v ~= false
+if present then
+	local ok, cv = pcall(cjson.decode, v)
+	present = not (ok and type(cv) == 'table' and cv.absent == true)
+end
+if (ARGV[1] == 'nx' and present) or (ARGV[1] == 'xx' and not present) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// casScript 仅当当前值的版本号与 ARGV[1] 一致时写入，旧数据及计数器无版本号时视为 0，不存在的标记及无法解析的值不写入
+var casScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then
+	return 0
+end
+local ok, cv = pcall(cjson.decode, v)
+if ok and type(cv) == 'number' then
+	cv = {}
+end
+if not ok or type(cv) ~= 'table' or cv.absent == true then
+	return 0
+end
+if (tonumber(cv.version) or 0) ~= tonumber(ARGV[1]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+func (r *redisCache) CompareAndSwap(key string, version int64, value interface{}, expiration ...time.Duration) (bool, error) {
+	return r.CompareAndSwapCtx(context.Background(), key, version, value, expiration...)
+}
+
+func (r *redisCache) CompareAndSwapCtx(ctx context.Context, key string, version int64, value interface{}, expiration ...time.Duration) (bool, error) {
+	if r.next != nil {
+		if err := r.flush(ctx, key); err != nil {
+			return false, err
+		}
+		ok, err := r.next.CompareAndSwapCtx(ctx, key, version, value, expiration...)
+		if ok {
+			_ = r.del(ctx, key)
+		}
+		return ok, err
+	}
+	if r.policy.ReadOnly {
+		return false, cache.ErrReadOnly
+	}
+	var dur time.Duration
+	if len(expiration) > 0 {
+		dur = expiration[0]
+	}
+	dur = r.policy.TTL(dur)
+	var px int64
+	if dur > 0 {
+		if px = dur.Milliseconds(); px == 0 {
+			px = 1
+		}
+	}
+	v, err := r.marshal(value, dur, cache.SetOptions{}, cache.NewVersion(version))
+	if err != nil {
+		return false, err
+	}
+	n, err := casScript.Run(ctx, r.client(), []string{key}, strconv.FormatInt(version, 10), v, px).Int()
+	if n == 1 {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
+	return n == 1, err
+}
+
+func (r *redisCache) SetAbsent(key string, expiration time.Duration) error {
+	return r.SetAbsentCtx(context.Background(), key, expiration)
+}
+
+func (r *redisCache) SetAbsentCtx(ctx context.Context, key string, expiration time.Duration) error {
+	var err error
+	if r.policy.Stores(r.next != nil) {
+		ttl := r.policy.TTL(expiration)
+		v := json.Stringify(&redisCacheValue{
+			ExpiredDuration: ttl,
+			CreatedAt:       time.Now(),
+			Version:         cache.NewVersion(0),
+			Absent:          true,
+		}, false)
+		err = r.client().Set(ctx, key, v, ttl).Err()
+	} else if !r.policy.ReadOnly {
+		err = r.del(ctx, key)
+	}
+	if err != nil {
+		return err
+	}
+	if r.next != nil {
+		// 先提交写回队列中的写入，避免覆盖标记
+		if err = r.flush(ctx, key); err == nil {
+			err = r.next.SetAbsentCtx(ctx, key, expiration)
+		}
+	} else if !r.policy.ReadOnly {
+		err = r.invalidate(ctx, cache.InvalidationSet, key)
+	}
 	return err
 }
 
+func (r *redisCache) IsAbsent(key string) bool {
+	return r.IsAbsentCtx(context.Background(), key)
+}
+
+func (r *redisCache) IsAbsentCtx(ctx context.Context, key string) bool {
+	if s, err := r.client().Get(ctx, key).Result(); err == nil {
+		return absent(s)
+	}
+	return r.next != nil && r.next.IsAbsentCtx(ctx, key)
+}
+
+func (r *redisCache) GetOrLoad(key string, dst interface{}, loader cache.LoaderFunc, ttl time.Duration) error {
+	return r.GetOrLoadCtx(context.Background(), key, dst, loader, ttl)
+}
+
+func (r *redisCache) GetOrLoadCtx(ctx context.Context, key string, dst interface{}, loader cache.LoaderFunc, ttl time.Duration) error {
+	return cache.GetOrLoad(ctx, r, key, dst, loader, ttl, r.load)
+}
+
+// Tracking 是否已开启 CLIENT TRACKING
+func (r *redisCache) Tracking() bool {
+	return r.tracking != nil
+}
+
 func (r *redisCache) Close() error {
-	if r.rdb != nil {
-		return r.rdb.Close()
+	if r.writeBack != nil {
+		r.writeBack.Close()
+	}
+	if r.tracking != nil {
+		r.tracking.close()
+	}
+	if r.pubsub != nil {
+		_ = r.pubsub.Close()
+	}
+	if r.sub != nil {
+		_ = r.sub.Close()
+	}
+	if c, ok := r.rdb.Load().(redis.UniversalClient); ok {
+		return c.Close()
 	}
 	return nil
 }
 
+// flush 同步提交 key 在写回队列中尚未提交的写入
+func (r *redisCache) flush(ctx context.Context, key string) error {
+	if r.writeBack == nil {
+		return nil
+	}
+	return r.writeBack.FlushKey(ctx, key)
+}
+
 func (r *redisCache) RemoteSupport() bool {
 	return true
 }
 
-func (r *redisCache) contains(pattern string, limit ...int) (map[string]string, error) {
+func (r *redisCache) contains(ctx context.Context, pattern string, limit ...int) (map[string]string, error) {
 
 	var count int64
 	if len(limit) > 0 {
@@ -603,12 +1683,12 @@ func (r *redisCache) contains(pattern string, limit ...int) (map[string]string,
 	for {
 		var keys []string
 		var err error
-		keys, cursor, err = r.rdb.Scan(context.Background(), cursor, pattern, count).Result()
+		keys, cursor, err = r.client().Scan(ctx, cursor, pattern, count).Result()
 		if err != nil {
 			return nil, err
 		}
 		for _, key := range keys {
-			s, err := r.rdb.Get(context.Background(), key).Result()
+			s, err := r.client().Get(ctx, key).Result()
 			if err != nil {
 				return nil, err
 			}
@@ -616,8 +1696,9 @@ func (r *redisCache) contains(pattern string, limit ...int) (map[string]string,
 				ExpiredDuration int64     `json:"expired_duration"`
 				CreatedAt       time.Time `json:"created_at"`
 				Data            string    `json:"data"`
+				Absent          bool      `json:"absent"`
 			}
-			if err = json.Parse(s, &v); err == nil {
+			if err = json.Parse(s, &v); err == nil && !v.Absent {
 				values[key] = v.Data
 			}
 		}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	trackingChannel = "__redis__:invalidate"
+	// recycleDelay 替换数据客户端后延迟关闭旧的客户端
+	recycleDelay = 10 * time.Second
+)
+
+// tracking 基于 RESP2 的 REDIRECT 模式实现客户端缓存：独立的连接订阅 __redis__:invalidate，
+// 数据连接建立时开启 CLIENT TRACKING 并把失效消息转发到该连接；
+// default 模式只跟踪本节点读取过的 key，bcast 模式跟踪 prefixes 下的所有 key
+type tracking struct {
+	id       int64
+	mode     string
+	prefixes []string
+	client   *redis.Client
+	pubsub   *redis.PubSub
+}
+
+// newTracking 服务端不支持 CLIENT TRACKING 或使用集群模式时返回错误
+func newTracking(ctx context.Context, opts *redis.UniversalOptions, mode string, prefixes []string) (*tracking, error) {
+	if opts.MasterName == "" && len(opts.Addrs) > 1 {
+		return nil, fmt.Errorf(`cache: client tracking is not supported in cluster mode`)
+	}
+	t := &tracking{mode: mode, prefixes: prefixes}
+
+	// 该客户端只用于订阅，每次建立连接（包括断线重连）时记录连接 ID
+	simple := opts.Simple()
+	simple.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		id, err := cn.ClientID(ctx).Result()
+		if err == nil {
+			atomic.StoreInt64(&t.id, id)
+		}
+		return err
+	}
+	t.client = redis.NewClient(simple)
+	t.pubsub = t.client.Subscribe(ctx, trackingChannel)
+	if _, err := t.pubsub.Receive(ctx); err != nil {
+		t.close()
+		return nil, err
+	}
+
+	// 使用临时连接探测服务端是否支持 CLIENT TRACKING
+	probe := redis.NewClient(opts.Simple())
+	defer probe.Close()
+	if err := probe.Do(ctx, t.args()...).Err(); err != nil {
+		t.close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *tracking) args() []interface{} {
+	args := []interface{}{"CLIENT", "TRACKING", "on", "REDIRECT", atomic.LoadInt64(&t.id)}
+	if t.mode == "bcast" {
+		args = append(args, "BCAST")
+		for _, prefix := range t.prefixes {
+			args = append(args, "PREFIX", prefix)
+		}
+	}
+	return append(args, "NOLOOP")
+}
+
+// onConnect 在数据连接建立时开启 CLIENT TRACKING
+func (t *tracking) onConnect(ctx context.Context, cn *redis.Conn) error {
+	return cn.Process(ctx, redis.NewCmd(ctx, t.args()...))
+}
+
+// listen 转发失效的 key，服务端执行 FLUSHALL/FLUSHDB 时 keys 为 nil；
+// 订阅连接重连（重复的订阅确认）或数据连接的重定向失效后调用 reset，data 返回当前的数据客户端
+func (t *tracking) listen(handler func(keys []string), reset func(), data func() redis.UniversalClient) {
+	go func() {
+		ctx := context.Background()
+		for {
+			msg, err := t.pubsub.ReceiveTimeout(ctx, subscribeTimeout)
+			if err != nil {
+				if err == redis.ErrClosed {
+					return
+				}
+				// RESP2 下 flush 的失效消息载荷为 nil，go-redis 会返回解析错误
+				if strings.Contains(err.Error(), "unsupported pubsub message payload: <nil>") {
+					handler(nil)
+				} else if e, ok := err.(net.Error); ok && e.Timeout() {
+					// 长时间没有消息时检测连接及重定向是否仍然有效
+					_ = t.pubsub.Ping(ctx)
+					if redirectBroken(ctx, data()) {
+						reset()
+					}
+				} else {
+					time.Sleep(100 * time.Millisecond)
+				}
+				continue
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind == "subscribe" {
+					reset()
+				}
+			case *redis.Message:
+				// RESP3 下重定向失效时服务端推送 tracking-redir-broken
+				if m.Channel == "tracking-redir-broken" {
+					reset()
+					continue
+				}
+				keys := m.PayloadSlice
+				if keys == nil && m.Payload != "" {
+					keys = []string{m.Payload}
+				}
+				if len(keys) > 0 {
+					handler(keys)
+				}
+			}
+		}
+	}()
+}
+
+// redirectBroken 通过 CLIENT TRACKINGINFO 检查数据连接的重定向是否失效；
+// RESP2 下服务端不会推送 tracking-redir-broken，只能主动查询，服务端低于 6.2 时返回 false
+func redirectBroken(ctx context.Context, c redis.UniversalClient) bool {
+	info, err := c.Do(ctx, "CLIENT", "TRACKINGINFO").Slice()
+	if err != nil {
+		return false
+	}
+	for i := 0; i+1 < len(info); i += 2 {
+		if name, _ := info[i].(string); name != "flags" {
+			continue
+		}
+		flags, _ := info[i+1].([]interface{})
+		for _, flag := range flags {
+			if flag == "broken_redirect" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *tracking) close() {
+	if t.pubsub != nil {
+		_ = t.pubsub.Close()
+	}
+	_ = t.client.Close()
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"github.com/buger/jsonparser"
+	"time"
+)
+
+// Entry 本地层级保存的值
+type Entry struct {
+	Meta
+	Data []byte
+	// Codec Data 的编码方式，为空时视为 JSON
+	Codec string
+	// Absent 为 true 时表示 key 不存在的标记
+	Absent bool
+}
+
+// Expired 是否已超过过期时间
+func (e *Entry) Expired() bool {
+	return e.ExpiredDuration > 0 && time.Now().After(e.CreatedAt.Add(e.ExpiredDuration))
+}
+
+// Decode 按写入时的编码方式解码 Data
+func (e *Entry) Decode(dst interface{}) error {
+	return Decode(e.Codec, e.Data, dst)
+}
+
+// plain Data 是否为 JSON 编码，可直接解析
+func (e *Entry) plain() bool {
+	return e.Codec == "" || e.Codec == CodecJSON
+}
+
+// Int 按整数读取 Data
+func (e *Entry) Int() (int64, error) {
+	if e.plain() {
+		return jsonparser.ParseInt(e.Data)
+	}
+	var n int64
+	err := e.Decode(&n)
+	return n, err
+}
+
+// Float 按浮点数读取 Data，与 JSON 一致，整数也可以按浮点数读取
+func (e *Entry) Float() (float64, error) {
+	if e.plain() {
+		return jsonparser.ParseFloat(e.Data)
+	}
+	var f float64
+	if err := e.Decode(&f); err != nil {
+		var n int64
+		if e.Decode(&n) != nil {
+			return 0, err
+		}
+		f = float64(n)
+	}
+	return f, nil
+}
+
+// Bool 按布尔值读取 Data
+func (e *Entry) Bool() (bool, error) {
+	if e.plain() {
+		return jsonparser.ParseBoolean(e.Data)
+	}
+	var b bool
+	err := e.Decode(&b)
+	return b, err
+}
+
+// meta 返回元数据的副本，调用方修改不影响本级保存的值
+func (e *Entry) meta() *Meta {
+	m := e.Meta
+	return &m
+}
@@ -1,6 +1,9 @@
 package cache
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Getter interface {
 	Has(path string) bool
@@ -58,3 +61,60 @@ type Getter interface {
 	DefaultGetBool(path string, defaultValue bool) bool
 	DefaultGetTime(path string, defaultValue time.Time) time.Time
 }
+
+type ContextGetter interface {
+	HasCtx(ctx context.Context, path string) bool
+	HasGetCtx(ctx context.Context, path string, dst interface{}) bool
+	HasGetIntCtx(ctx context.Context, path string) (int, bool)
+	HasGetInt8Ctx(ctx context.Context, path string) (int8, bool)
+	HasGetInt16Ctx(ctx context.Context, path string) (int16, bool)
+	HasGetInt32Ctx(ctx context.Context, path string) (int32, bool)
+	HasGetInt64Ctx(ctx context.Context, path string) (int64, bool)
+	HasGetUintCtx(ctx context.Context, path string) (uint, bool)
+	HasGetUint8Ctx(ctx context.Context, path string) (uint8, bool)
+	HasGetUint16Ctx(ctx context.Context, path string) (uint16, bool)
+	HasGetUint32Ctx(ctx context.Context, path string) (uint32, bool)
+	HasGetUint64Ctx(ctx context.Context, path string) (uint64, bool)
+	HasGetFloatCtx(ctx context.Context, path string) (float64, bool)
+	HasGetFloat32Ctx(ctx context.Context, path string) (float32, bool)
+	HasGetFloat64Ctx(ctx context.Context, path string) (float64, bool)
+	HasGetStringCtx(ctx context.Context, path string) (string, bool)
+	HasGetBoolCtx(ctx context.Context, path string) (bool, bool)
+	HasGetTimeCtx(ctx context.Context, path string) (time.Time, bool)
+
+	GetCtx(ctx context.Context, path string, dst interface{})
+	GetIntCtx(ctx context.Context, path string) int
+	GetInt8Ctx(ctx context.Context, path string) int8
+	GetInt16Ctx(ctx context.Context, path string) int16
+	GetInt32Ctx(ctx context.Context, path string) int32
+	GetInt64Ctx(ctx context.Context, path string) int64
+	GetUintCtx(ctx context.Context, path string) uint
+	GetUint8Ctx(ctx context.Context, path string) uint8
+	GetUint16Ctx(ctx context.Context, path string) uint16
+	GetUint32Ctx(ctx context.Context, path string) uint32
+	GetUint64Ctx(ctx context.Context, path string) uint64
+	GetFloatCtx(ctx context.Context, path string) float64
+	GetFloat32Ctx(ctx context.Context, path string) float32
+	GetFloat64Ctx(ctx context.Context, path string) float64
+	GetStringCtx(ctx context.Context, path string) string
+	GetBoolCtx(ctx context.Context, path string) bool
+	GetTimeCtx(ctx context.Context, path string) time.Time
+
+	DefaultGetCtx(ctx context.Context, path string, dst interface{}, defaultValue interface{})
+	DefaultGetIntCtx(ctx context.Context, path string, defaultValue int) int
+	DefaultGetInt8Ctx(ctx context.Context, path string, defaultValue int8) int8
+	DefaultGetInt16Ctx(ctx context.Context, path string, defaultValue int16) int16
+	DefaultGetInt32Ctx(ctx context.Context, path string, defaultValue int32) int32
+	DefaultGetInt64Ctx(ctx context.Context, path string, defaultValue int64) int64
+	DefaultGetUintCtx(ctx context.Context, path string, defaultValue uint) uint
+	DefaultGetUint8Ctx(ctx context.Context, path string, defaultValue uint8) uint8
+	DefaultGetUint16Ctx(ctx context.Context, path string, defaultValue uint16) uint16
+	DefaultGetUint32Ctx(ctx context.Context, path string, defaultValue uint32) uint32
+	DefaultGetUint64Ctx(ctx context.Context, path string, defaultValue uint64) uint64
+	DefaultGetFloatCtx(ctx context.Context, path string, defaultValue float64) float64
+	DefaultGetFloat32Ctx(ctx context.Context, path string, defaultValue float32) float32
+	DefaultGetFloat64Ctx(ctx context.Context, path string, defaultValue float64) float64
+	DefaultGetStringCtx(ctx context.Context, path string, defaultValue string) string
+	DefaultGetBoolCtx(ctx context.Context, path string, defaultValue bool) bool
+	DefaultGetTimeCtx(ctx context.Context, path string, defaultValue time.Time) time.Time
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/iamdanielyin/cache/json"
+	"strings"
+	"time"
+)
+
+// InvalidationVersion 当前失效消息的协议版本
+const InvalidationVersion = 1
+
+// InvalidationOp 触发失效的操作类型
+type InvalidationOp string
+
+const (
+	InvalidationSet InvalidationOp = "set"
+	InvalidationDel InvalidationOp = "del"
+)
+
+// Invalidation 节点间广播的失效消息，接收方删除本地各级中的 Keys 及以 Prefixes 开头的 key
+type Invalidation struct {
+	Version   int            `json:"v"`
+	Op        InvalidationOp `json:"op"`
+	Keys      []string       `json:"keys,omitempty"`
+	Prefixes  []string       `json:"prefixes,omitempty"`
+	Origin    string         `json:"origin,omitempty"`
+	Timestamp time.Time      `json:"ts"`
+	// Seq 消息序号，写入失效日志后由驱动填充，用于断线后补发
+	Seq string `json:"seq,omitempty"`
+}
+
+func NewInvalidation(origin string, op InvalidationOp, keys ...string) *Invalidation {
+	return &Invalidation{
+		Version:   InvalidationVersion,
+		Op:        op,
+		Keys:      keys,
+		Origin:    origin,
+		Timestamp: time.Now(),
+	}
+}
+
+func (i *Invalidation) String() string {
+	return json.Stringify(i, false)
+}
+
+// Empty 消息中没有需要删除的 key
+func (i *Invalidation) Empty() bool {
+	return len(i.Keys) == 0 && len(i.Prefixes) == 0
+}
+
+// ParseInvalidation 解析失效消息，兼容旧版逗号分隔的 key 列表；不支持的协议版本返回错误
+func ParseInvalidation(data string) (*Invalidation, error) {
+	if strings.HasPrefix(data, "{") {
+		var i Invalidation
+		if err := json.Parse(data, &i); err != nil {
+			return nil, err
+		}
+		if i.Version != InvalidationVersion {
+			return nil, fmt.Errorf(`cache: unsupported invalidation version: %d`, i.Version)
+		}
+		return &i, nil
+	}
+
+	i := &Invalidation{Op: InvalidationDel}
+	if data != "" {
+		i.Keys = strings.Split(data, ",")
+	}
+	return i, nil
+}
+
+// WriteObserver 由需要知道其他节点写入了哪些 key 的层级实现（如开启布隆过滤器的 ldb），
+// Invalidate 收到写入消息时先调用 ObserveWrite 再删除本地的旧值
+type WriteObserver interface {
+	ObserveWrite(keys ...string)
+}
+
+// Invalidate 将其他节点的失效消息应用到 c 之前的各级，每级只删除一次；
+// 支持远程消息的层级由各节点共享，写入方已更新，不做处理
+func Invalidate(ctx context.Context, c Cache, inv *Invalidation) error {
+	var err error
+	for p := c.Previous(); p != nil; p = p.Previous() {
+		if p.RemoteSupport() {
+			continue
+		}
+		if o, ok := p.(WriteObserver); ok && inv.Op == InvalidationSet && len(inv.Keys) > 0 {
+			o.ObserveWrite(inv.Keys...)
+		}
+		if len(inv.Keys) > 0 {
+			if e := p.EvictCtx(ctx, inv.Keys...); e != nil && err == nil {
+				err = e
+			}
+		}
+		if len(inv.Prefixes) > 0 {
+			if e := p.EvictPrefixCtx(ctx, inv.Prefixes...); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,1058 @@
+package cache
+
+import (
+	"context"
+	"github.com/iamdanielyin/cache/json"
+	"time"
+)
+
+// Backend 本地层级的存储，由驱动实现
+type Backend interface {
+	// Get 返回 key 对应的值，不存在或已过期时返回 false；不存在的标记同样返回 true
+	Get(key string) (*Entry, bool)
+	// Put 保存 key 对应的值
+	Put(key string, e *Entry) error
+	// Delete 仅删除本级的 key
+	Delete(keys ...string) error
+}
+
+// BatchBackend 由支持批量写入的 Backend 实现，MSet 时一次写入所有值
+type BatchBackend interface {
+	PutBatch(entries map[string]*Entry) error
+}
+
+// KeyFilter 由 Backend 可选实现，MayContain 返回 false 时 key 一定没有写入过，读取时不再访问下一级；
+// 同时实现 WriteObserver 以记录不保存在本级的写入
+type KeyFilter interface {
+	MayContain(key string) bool
+}
+
+// Level 本地层级的公共部分：在 Backend 之上实现各类读取、读取下一级及回填、写入及删除的传递；
+// 驱动内嵌 *Level，只需实现前缀查询、原子操作等与存储相关的方法
+type Level struct {
+	// self 内嵌 Level 的驱动，刷新及加载时以它为起点
+	self      Cache
+	backend   Backend
+	filter    KeyFilter
+	load      LoadOptions
+	writeBack *WriteBack
+	codec     Codec
+	policy    Policy
+	next      Cache
+	previous  Cache
+}
+
+// NewLevel 按 codec、load_* 及 write_back 等配置创建 Level
+func NewLevel(self Cache, backend Backend, m map[string]interface{}) (*Level, error) {
+	codec, err := ParseCodec(m)
+	if err != nil {
+		return nil, err
+	}
+	l := &Level{
+		self:    self,
+		backend: backend,
+		load:    ParseLoadOptions(m),
+		codec:   codec,
+	}
+	l.filter, _ = backend.(KeyFilter)
+	// write_back 为 true 时异步写入下一级
+	if opts := ParseWriteBackOptions(m); opts != nil {
+		l.writeBack = NewWriteBack(func() Cache { return l.next }, *opts)
+	}
+	return l, nil
+}
+
+// Policy 本级的读写策略
+func (l *Level) Policy() Policy {
+	return l.policy
+}
+
+// NewEntry 按本级的编码方式编码 value，exp 为按策略调整后的过期时间
+func (l *Level) NewEntry(value interface{}, exp time.Duration, opts SetOptions, version int64) (*Entry, error) {
+	codec, raw, err := Encode(l.codec, value)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Meta: Meta{
+			Version:         version,
+			CreatedAt:       time.Now(),
+			ExpiredDuration: exp,
+			SoftDuration:    opts.SoftTTL,
+			Delta:           opts.Delta,
+		},
+		Data:  raw,
+		Codec: codec,
+	}, nil
+}
+
+// Flush 同步提交 key 在写回队列中尚未提交的写入，原子操作传递给下一级前调用
+func (l *Level) Flush(ctx context.Context, key string) error {
+	if l.writeBack == nil {
+		return nil
+	}
+	return l.writeBack.FlushKey(ctx, key)
+}
+
+// ObserveWrite 记录其他节点写入的 key，Backend 未实现 WriteObserver 时忽略
+func (l *Level) ObserveWrite(keys ...string) {
+	if o, ok := l.backend.(WriteObserver); ok {
+		o.ObserveWrite(keys...)
+	}
+}
+
+// Close 停止写回队列，由驱动在关闭存储前调用
+func (l *Level) Close() error {
+	if l.writeBack != nil {
+		l.writeBack.Close()
+	}
+	return nil
+}
+
+// get 读取本级的值，key 带有不存在的标记时返回该标记及 false；超过软过期时间的值在后台刷新
+func (l *Level) get(ctx context.Context, key string) (*Entry, bool) {
+	if ctx.Err() != nil || (l.filter != nil && !l.filter.MayContain(key)) {
+		return nil, false
+	}
+	e, has := l.backend.Get(key)
+	if !has {
+		return nil, false
+	}
+	if e.Absent {
+		return e, false
+	}
+	if e.SoftDuration > 0 {
+		Revalidate(l.self, key, e.meta())
+	}
+	return e, true
+}
+
+// forward 本级未命中、没有不存在的标记且 key 可能写入过时读取下一级
+func (l *Level) forward(key string, e *Entry) bool {
+	return l.next != nil && (e == nil || !e.Absent) && (l.filter == nil || l.filter.MayContain(key))
+}
+
+// fetch 读取本级并用 parse 解析，无法解析时视为本级未命中；未命中时通过 next 读取下一级并回填本级
+func fetch[T any](ctx context.Context, l *Level, key string, parse func(e *Entry) (T, error), next func(c Cache) (T, bool)) (T, bool) {
+	e, has := l.get(ctx, key)
+	if has {
+		if v, err := parse(e); err == nil {
+			return v, true
+		}
+	}
+	var zero T
+	if !l.forward(key, e) {
+		return zero, false
+	}
+	v, ok := next(l.next)
+	if !ok {
+		return zero, false
+	}
+	if ttl, ok := l.next.TTLCtx(ctx, key); ok {
+		l.backfill(key, v, ttl)
+	}
+	return v, true
+}
+
+// observe 记录经过本级的写入，本级不保存时之后仍会读取下一级
+func (l *Level) observe(keys ...string) {
+	if l.filter != nil {
+		l.ObserveWrite(keys...)
+	}
+}
+
+// store 编码并写入本级，exp 为按策略调整后的过期时间
+func (l *Level) store(key string, value interface{}, exp time.Duration, opts SetOptions, version int64) error {
+	e, err := l.NewEntry(value, exp, opts, version)
+	if err != nil {
+		return err
+	}
+	return l.backend.Put(key, e)
+}
+
+// version 返回本级写入的版本号；版本号以最后一级为准，之前的层级写入时记为 0，HasGetMeta 读到 0 时读取下一级
+func (l *Level) version() int64 {
+	if l.next != nil {
+		return 0
+	}
+	return NewVersion(0)
+}
+
+// backfill 将下一级命中的值写入本级，不再传递给下一级
+func (l *Level) backfill(key string, value interface{}, ttl time.Duration) {
+	if l.policy.Populate() {
+		_ = l.store(key, value, l.policy.TTL(ttl), SetOptions{}, 0)
+	}
+}
+
+// backfillMeta 将下一级命中的值连同版本号及重新计算的耗时写入本级
+func (l *Level) backfillMeta(key string, value interface{}, meta *Meta) {
+	ttl := meta.TTL()
+	if !l.policy.Populate() || (meta.ExpiredDuration > 0 && ttl <= 0) {
+		return
+	}
+	_ = l.store(key, value, l.policy.TTL(ttl), SetOptions{Delta: meta.Delta}, meta.Version)
+}
+
+func (l *Level) Publish(channel string, message interface{}) error {
+	return l.PublishCtx(context.Background(), channel, message)
+}
+
+func (l *Level) PublishCtx(ctx context.Context, channel string, message interface{}) error {
+	if l.next == nil {
+		return ErrUnsupportedPubSub
+	}
+	return l.next.PublishCtx(ctx, channel, message)
+}
+
+func (l *Level) Subscribe(channels []string, handler func(string, string)) error {
+	return l.SubscribeCtx(context.Background(), channels, handler)
+}
+
+func (l *Level) SubscribeCtx(ctx context.Context, channels []string, handler func(string, string)) error {
+	if l.next == nil {
+		return ErrUnsupportedPubSub
+	}
+	return l.next.SubscribeCtx(ctx, channels, handler)
+}
+
+func (l *Level) PSubscribe(patterns []string, handler func(string, string)) error {
+	return l.PSubscribeCtx(context.Background(), patterns, handler)
+}
+
+func (l *Level) PSubscribeCtx(ctx context.Context, patterns []string, handler func(string, string)) error {
+	if l.next == nil {
+		return ErrUnsupportedPubSub
+	}
+	return l.next.PSubscribeCtx(ctx, patterns, handler)
+}
+
+func (l *Level) TTL(path string) (time.Duration, bool) {
+	return l.TTLCtx(context.Background(), path)
+}
+
+func (l *Level) TTLCtx(ctx context.Context, path string) (time.Duration, bool) {
+	e, has := l.get(ctx, path)
+	if !has {
+		return 0, has
+	}
+	return e.TTL(), has
+}
+
+func (l *Level) Has(path string) bool {
+	return l.HasCtx(context.Background(), path)
+}
+
+func (l *Level) HasCtx(ctx context.Context, path string) bool {
+	e, has := l.get(ctx, path)
+	if !has && l.forward(path, e) {
+		has = l.next.HasCtx(ctx, path)
+	}
+	return has
+}
+
+func (l *Level) HasGet(path string, dst interface{}) bool {
+	return l.HasGetCtx(context.Background(), path, dst)
+}
+
+func (l *Level) HasGetCtx(ctx context.Context, path string, dst interface{}) bool {
+	_, has := fetch(ctx, l, path, func(e *Entry) (interface{}, error) {
+		return dst, e.Decode(dst)
+	}, func(c Cache) (interface{}, bool) {
+		return dst, c.HasGetCtx(ctx, path, dst)
+	})
+	return has
+}
+
+func (l *Level) HasGetInt(path string) (int, bool) {
+	return l.HasGetIntCtx(context.Background(), path)
+}
+
+func (l *Level) HasGetIntCtx(ctx context.Context, path string) (int, bool) {
+	return fetch(ctx, l, path, func(e *Entry) (int, error) {
+		v, err := e.Int()
+		return int(v), err
+	}, func(c Cache) (int, bool) {
+		return c.HasGetIntCtx(ctx, path)
+	})
+}
+
+func (l *Level) HasGetInt8(path string) (int8, bool) {
+	return l.HasGetInt8Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetInt8Ctx(ctx context.Context, path string) (int8, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return int8(v), has
+}
+
+func (l *Level) HasGetInt16(path string) (int16, bool) {
+	return l.HasGetInt16Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetInt16Ctx(ctx context.Context, path string) (int16, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return int16(v), has
+}
+
+func (l *Level) HasGetInt32(path string) (int32, bool) {
+	return l.HasGetInt32Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetInt32Ctx(ctx context.Context, path string) (int32, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return int32(v), has
+}
+
+func (l *Level) HasGetInt64(path string) (int64, bool) {
+	return l.HasGetInt64Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetInt64Ctx(ctx context.Context, path string) (int64, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return int64(v), has
+}
+
+func (l *Level) HasGetUint(path string) (uint, bool) {
+	return l.HasGetUintCtx(context.Background(), path)
+}
+
+func (l *Level) HasGetUintCtx(ctx context.Context, path string) (uint, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return uint(v), has
+}
+
+func (l *Level) HasGetUint8(path string) (uint8, bool) {
+	return l.HasGetUint8Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetUint8Ctx(ctx context.Context, path string) (uint8, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return uint8(v), has
+}
+
+func (l *Level) HasGetUint16(path string) (uint16, bool) {
+	return l.HasGetUint16Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetUint16Ctx(ctx context.Context, path string) (uint16, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return uint16(v), has
+}
+
+func (l *Level) HasGetUint32(path string) (uint32, bool) {
+	return l.HasGetUint32Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetUint32Ctx(ctx context.Context, path string) (uint32, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return uint32(v), has
+}
+
+func (l *Level) HasGetUint64(path string) (uint64, bool) {
+	return l.HasGetUint64Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetUint64Ctx(ctx context.Context, path string) (uint64, bool) {
+	v, has := l.HasGetIntCtx(ctx, path)
+	return uint64(v), has
+}
+
+func (l *Level) HasGetFloat(path string) (float64, bool) {
+	return l.HasGetFloatCtx(context.Background(), path)
+}
+
+func (l *Level) HasGetFloatCtx(ctx context.Context, path string) (float64, bool) {
+	return fetch(ctx, l, path, func(e *Entry) (float64, error) {
+		return e.Float()
+	}, func(c Cache) (float64, bool) {
+		return c.HasGetFloatCtx(ctx, path)
+	})
+}
+
+func (l *Level) HasGetFloat32(path string) (float32, bool) {
+	return l.HasGetFloat32Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetFloat32Ctx(ctx context.Context, path string) (float32, bool) {
+	v, has := l.HasGetFloatCtx(ctx, path)
+	return float32(v), has
+}
+
+func (l *Level) HasGetFloat64(path string) (float64, bool) {
+	return l.HasGetFloat64Ctx(context.Background(), path)
+}
+
+func (l *Level) HasGetFloat64Ctx(ctx context.Context, path string) (float64, bool) {
+	return l.HasGetFloatCtx(ctx, path)
+}
+
+func (l *Level) HasGetString(path string) (string, bool) {
+	return l.HasGetStringCtx(context.Background(), path)
+}
+
+func (l *Level) HasGetStringCtx(ctx context.Context, path string) (string, bool) {
+	return fetch(ctx, l, path, func(e *Entry) (string, error) {
+		var v string
+		err := e.Decode(&v)
+		return v, err
+	}, func(c Cache) (string, bool) {
+		return c.HasGetStringCtx(ctx, path)
+	})
+}
+
+func (l *Level) HasGetBool(path string) (bool, bool) {
+	return l.HasGetBoolCtx(context.Background(), path)
+}
+
+func (l *Level) HasGetBoolCtx(ctx context.Context, path string) (bool, bool) {
+	return fetch(ctx, l, path, func(e *Entry) (bool, error) {
+		return e.Bool()
+	}, func(c Cache) (bool, bool) {
+		return c.HasGetBoolCtx(ctx, path)
+	})
+}
+
+func (l *Level) HasGetTime(path string) (time.Time, bool) {
+	return l.HasGetTimeCtx(context.Background(), path)
+}
+
+func (l *Level) HasGetTimeCtx(ctx context.Context, path string) (time.Time, bool) {
+	return fetch(ctx, l, path, func(e *Entry) (time.Time, error) {
+		var v time.Time
+		err := e.Decode(&v)
+		return v, err
+	}, func(c Cache) (time.Time, bool) {
+		return c.HasGetTimeCtx(ctx, path)
+	})
+}
+
+func (l *Level) Get(path string, dst interface{}) {
+	l.GetCtx(context.Background(), path, dst)
+}
+
+func (l *Level) GetCtx(ctx context.Context, path string, dst interface{}) {
+	_ = l.HasGetCtx(ctx, path, dst)
+}
+
+func (l *Level) GetInt(path string) int {
+	return l.GetIntCtx(context.Background(), path)
+}
+
+func (l *Level) GetIntCtx(ctx context.Context, path string) int {
+	v, _ := l.HasGetIntCtx(ctx, path)
+	return v
+}
+
+func (l *Level) GetInt8(path string) int8 {
+	return l.GetInt8Ctx(context.Background(), path)
+}
+
+func (l *Level) GetInt8Ctx(ctx context.Context, path string) int8 {
+	v, _ := l.HasGetInt8Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetInt16(path string) int16 {
+	return l.GetInt16Ctx(context.Background(), path)
+}
+
+func (l *Level) GetInt16Ctx(ctx context.Context, path string) int16 {
+	v, _ := l.HasGetInt16Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetInt32(path string) int32 {
+	return l.GetInt32Ctx(context.Background(), path)
+}
+
+func (l *Level) GetInt32Ctx(ctx context.Context, path string) int32 {
+	v, _ := l.HasGetInt32Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetInt64(path string) int64 {
+	return l.GetInt64Ctx(context.Background(), path)
+}
+
+func (l *Level) GetInt64Ctx(ctx context.Context, path string) int64 {
+	v, _ := l.HasGetInt64Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetUint(path string) uint {
+	return l.GetUintCtx(context.Background(), path)
+}
+
+func (l *Level) GetUintCtx(ctx context.Context, path string) uint {
+	v, _ := l.HasGetUintCtx(ctx, path)
+	return v
+}
+
+func (l *Level) GetUint8(path string) uint8 {
+	return l.GetUint8Ctx(context.Background(), path)
+}
+
+func (l *Level) GetUint8Ctx(ctx context.Context, path string) uint8 {
+	v, _ := l.HasGetUint8Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetUint16(path string) uint16 {
+	return l.GetUint16Ctx(context.Background(), path)
+}
+
+func (l *Level) GetUint16Ctx(ctx context.Context, path string) uint16 {
+	v, _ := l.HasGetUint16Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetUint32(path string) uint32 {
+	return l.GetUint32Ctx(context.Background(), path)
+}
+
+func (l *Level) GetUint32Ctx(ctx context.Context, path string) uint32 {
+	v, _ := l.HasGetUint32Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetUint64(path string) uint64 {
+	return l.GetUint64Ctx(context.Background(), path)
+}
+
+func (l *Level) GetUint64Ctx(ctx context.Context, path string) uint64 {
+	v, _ := l.HasGetUint64Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetFloat(path string) float64 {
+	return l.GetFloatCtx(context.Background(), path)
+}
+
+func (l *Level) GetFloatCtx(ctx context.Context, path string) float64 {
+	v, _ := l.HasGetFloatCtx(ctx, path)
+	return v
+}
+
+func (l *Level) GetFloat32(path string) float32 {
+	return l.GetFloat32Ctx(context.Background(), path)
+}
+
+func (l *Level) GetFloat32Ctx(ctx context.Context, path string) float32 {
+	v, _ := l.HasGetFloat32Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetFloat64(path string) float64 {
+	return l.GetFloat64Ctx(context.Background(), path)
+}
+
+func (l *Level) GetFloat64Ctx(ctx context.Context, path string) float64 {
+	v, _ := l.HasGetFloat64Ctx(ctx, path)
+	return v
+}
+
+func (l *Level) GetString(path string) string {
+	return l.GetStringCtx(context.Background(), path)
+}
+
+func (l *Level) GetStringCtx(ctx context.Context, path string) string {
+	v, _ := l.HasGetStringCtx(ctx, path)
+	return v
+}
+
+func (l *Level) GetBool(path string) bool {
+	return l.GetBoolCtx(context.Background(), path)
+}
+
+func (l *Level) GetBoolCtx(ctx context.Context, path string) bool {
+	v, _ := l.HasGetBoolCtx(ctx, path)
+	return v
+}
+
+func (l *Level) GetTime(path string) time.Time {
+	return l.GetTimeCtx(context.Background(), path)
+}
+
+func (l *Level) GetTimeCtx(ctx context.Context, path string) time.Time {
+	v, _ := l.HasGetTimeCtx(ctx, path)
+	return v
+}
+
+func (l *Level) DefaultGet(path string, dst interface{}, defaultValue interface{}) {
+	l.DefaultGetCtx(context.Background(), path, dst, defaultValue)
+}
+
+func (l *Level) DefaultGetCtx(ctx context.Context, path string, dst interface{}, defaultValue interface{}) {
+	if !l.HasGetCtx(ctx, path, dst) {
+		_ = json.Copy(defaultValue, dst)
+	}
+}
+
+func (l *Level) DefaultGetInt(path string, defaultValue int) int {
+	return l.DefaultGetIntCtx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetIntCtx(ctx context.Context, path string, defaultValue int) int {
+	if v, has := l.HasGetIntCtx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetInt8(path string, defaultValue int8) int8 {
+	return l.DefaultGetInt8Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetInt8Ctx(ctx context.Context, path string, defaultValue int8) int8 {
+	if v, has := l.HasGetInt8Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetInt16(path string, defaultValue int16) int16 {
+	return l.DefaultGetInt16Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetInt16Ctx(ctx context.Context, path string, defaultValue int16) int16 {
+	if v, has := l.HasGetInt16Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetInt32(path string, defaultValue int32) int32 {
+	return l.DefaultGetInt32Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetInt32Ctx(ctx context.Context, path string, defaultValue int32) int32 {
+	if v, has := l.HasGetInt32Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetInt64(path string, defaultValue int64) int64 {
+	return l.DefaultGetInt64Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetInt64Ctx(ctx context.Context, path string, defaultValue int64) int64 {
+	if v, has := l.HasGetInt64Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetUint(path string, defaultValue uint) uint {
+	return l.DefaultGetUintCtx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetUintCtx(ctx context.Context, path string, defaultValue uint) uint {
+	if v, has := l.HasGetUintCtx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetUint8(path string, defaultValue uint8) uint8 {
+	return l.DefaultGetUint8Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetUint8Ctx(ctx context.Context, path string, defaultValue uint8) uint8 {
+	if v, has := l.HasGetUint8Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetUint16(path string, defaultValue uint16) uint16 {
+	return l.DefaultGetUint16Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetUint16Ctx(ctx context.Context, path string, defaultValue uint16) uint16 {
+	if v, has := l.HasGetUint16Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetUint32(path string, defaultValue uint32) uint32 {
+	return l.DefaultGetUint32Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetUint32Ctx(ctx context.Context, path string, defaultValue uint32) uint32 {
+	if v, has := l.HasGetUint32Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetUint64(path string, defaultValue uint64) uint64 {
+	return l.DefaultGetUint64Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetUint64Ctx(ctx context.Context, path string, defaultValue uint64) uint64 {
+	if v, has := l.HasGetUint64Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetFloat(path string, defaultValue float64) float64 {
+	return l.DefaultGetFloatCtx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetFloatCtx(ctx context.Context, path string, defaultValue float64) float64 {
+	if v, has := l.HasGetFloatCtx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetFloat32(path string, defaultValue float32) float32 {
+	return l.DefaultGetFloat32Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetFloat32Ctx(ctx context.Context, path string, defaultValue float32) float32 {
+	if v, has := l.HasGetFloat32Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetFloat64(path string, defaultValue float64) float64 {
+	return l.DefaultGetFloat64Ctx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetFloat64Ctx(ctx context.Context, path string, defaultValue float64) float64 {
+	if v, has := l.HasGetFloat64Ctx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetString(path string, defaultValue string) string {
+	return l.DefaultGetStringCtx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetStringCtx(ctx context.Context, path string, defaultValue string) string {
+	if v, has := l.HasGetStringCtx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetBool(path string, defaultValue bool) bool {
+	return l.DefaultGetBoolCtx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetBoolCtx(ctx context.Context, path string, defaultValue bool) bool {
+	if v, has := l.HasGetBoolCtx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) DefaultGetTime(path string, defaultValue time.Time) time.Time {
+	return l.DefaultGetTimeCtx(context.Background(), path, defaultValue)
+}
+
+func (l *Level) DefaultGetTimeCtx(ctx context.Context, path string, defaultValue time.Time) time.Time {
+	if v, has := l.HasGetTimeCtx(ctx, path); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (l *Level) Set(key string, value interface{}, expiration ...time.Duration) error {
+	return l.SetCtx(context.Background(), key, value, expiration...)
+}
+
+func (l *Level) SetCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) error {
+	var opts SetOptions
+	if len(expiration) > 0 {
+		opts.Expiration = expiration[0]
+	}
+	return l.SetWithOptionsCtx(ctx, key, value, opts)
+}
+
+func (l *Level) SetWithOptions(key string, value interface{}, opts SetOptions) error {
+	return l.SetWithOptionsCtx(context.Background(), key, value, opts)
+}
+
+func (l *Level) SetWithOptionsCtx(ctx context.Context, key string, value interface{}, opts SetOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.observe(key)
+	var err error
+	if l.policy.Stores(l.next != nil) {
+		err = l.store(key, value, l.policy.TTL(opts.Expiration), opts, l.version())
+	} else if !l.policy.ReadOnly {
+		// 写绕过时删除本级的旧值
+		err = l.backend.Delete(key)
+	}
+	if err == nil && l.next != nil {
+		if l.writeBack != nil {
+			err = l.writeBack.Set(ctx, key, value, opts)
+		} else {
+			err = l.next.SetWithOptionsCtx(ctx, key, value, opts)
+		}
+	}
+	return err
+}
+
+func (l *Level) MGet(dst map[string]interface{}) (map[string]time.Duration, error) {
+	return l.MGetCtx(context.Background(), dst)
+}
+
+func (l *Level) MGetCtx(ctx context.Context, dst map[string]interface{}) (map[string]time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var (
+		found   = make(map[string]time.Duration)
+		missing = make(map[string]interface{})
+	)
+	for key, v := range dst {
+		// 与单个 key 的读取一致，超过软过期时间的值在后台刷新，无法解码到 dst 时视为本级未命中
+		e, has := l.get(ctx, key)
+		if has && e.Decode(v) == nil {
+			found[key] = e.TTL()
+		} else if l.forward(key, e) {
+			missing[key] = v
+		}
+	}
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	nextFound, err := l.next.MGetCtx(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	// 仅回填下一级命中的 key
+	for key, ttl := range nextFound {
+		found[key] = ttl
+		l.backfill(key, missing[key], ttl)
+	}
+	return found, nil
+}
+
+func (l *Level) MSet(values map[string]interface{}, expiration ...time.Duration) error {
+	return l.MSetCtx(context.Background(), values, expiration...)
+}
+
+func (l *Level) MSetCtx(ctx context.Context, values map[string]interface{}, expiration ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var exp time.Duration
+	if len(expiration) > 0 {
+		exp = expiration[0]
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	l.observe(keys...)
+	var err error
+	if l.policy.Stores(l.next != nil) {
+		entries := make(map[string]*Entry, len(values))
+		for key, value := range values {
+			e, err := l.NewEntry(value, l.policy.TTL(exp), SetOptions{}, l.version())
+			if err != nil {
+				return err
+			}
+			entries[key] = e
+		}
+		err = l.putBatch(entries)
+	} else if !l.policy.ReadOnly {
+		err = l.backend.Delete(keys...)
+	}
+	if err == nil && l.next != nil {
+		if l.writeBack != nil {
+			err = l.writeBack.MSet(ctx, values, expiration...)
+		} else {
+			err = l.next.MSetCtx(ctx, values, expiration...)
+		}
+	}
+	return err
+}
+
+// putBatch Backend 支持批量写入时一次写入，否则逐个写入
+func (l *Level) putBatch(entries map[string]*Entry) error {
+	if b, ok := l.backend.(BatchBackend); ok {
+		return b.PutBatch(entries)
+	}
+	for key, e := range entries {
+		if err := l.backend.Put(key, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Level) Del(keys ...string) error {
+	return l.DelCtx(context.Background(), keys...)
+}
+
+func (l *Level) DelCtx(ctx context.Context, keys ...string) error {
+	return l.MDelCtx(ctx, keys...)
+}
+
+func (l *Level) MDel(keys ...string) error {
+	return l.MDelCtx(context.Background(), keys...)
+}
+
+func (l *Level) MDelCtx(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	if !l.policy.ReadOnly {
+		err = l.backend.Delete(keys...)
+	}
+	// 本级删除失败时仍删除下一级，返回第一个错误
+	var nextErr error
+	if l.writeBack != nil {
+		nextErr = l.writeBack.Del(ctx, keys...)
+	} else if l.next != nil {
+		nextErr = l.next.MDelCtx(ctx, keys...)
+	}
+	if err == nil {
+		err = nextErr
+	}
+	return err
+}
+
+func (l *Level) Evict(keys ...string) error {
+	return l.EvictCtx(context.Background(), keys...)
+}
+
+func (l *Level) EvictCtx(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.backend.Delete(keys...)
+}
+
+func (l *Level) DelPrefix(prefixes ...string) error {
+	return l.DelPrefixCtx(context.Background(), prefixes...)
+}
+
+func (l *Level) DelPrefixCtx(ctx context.Context, prefixes ...string) error {
+	var err error
+	if !l.policy.ReadOnly {
+		err = l.self.EvictPrefixCtx(ctx, prefixes...)
+	}
+	if err == nil && l.next != nil {
+		if l.writeBack != nil {
+			err = l.writeBack.Flush(ctx)
+		}
+		if err == nil {
+			err = l.next.DelPrefixCtx(ctx, prefixes...)
+		}
+	}
+	return err
+}
+
+func (l *Level) HasGetMeta(key string, dst interface{}) (*Meta, bool) {
+	return l.HasGetMetaCtx(context.Background(), key, dst)
+}
+
+func (l *Level) HasGetMetaCtx(ctx context.Context, key string, dst interface{}) (*Meta, bool) {
+	// 版本号以最后一级为准，本级写入的值没有版本号时读取下一级
+	e, has := l.get(ctx, key)
+	if has && (l.next == nil || e.Version != 0) && e.Decode(dst) == nil {
+		return e.meta(), true
+	}
+	if !l.forward(key, e) {
+		return nil, false
+	}
+	_ = l.Flush(ctx, key)
+	meta, has := l.next.HasGetMetaCtx(ctx, key, dst)
+	if has {
+		l.backfillMeta(key, dst, meta)
+	}
+	return meta, has
+}
+
+func (l *Level) SetAbsent(key string, expiration time.Duration) error {
+	return l.SetAbsentCtx(context.Background(), key, expiration)
+}
+
+func (l *Level) SetAbsentCtx(ctx context.Context, key string, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.observe(key)
+	var err error
+	if l.policy.Stores(l.next != nil) {
+		err = l.backend.Put(key, &Entry{
+			Meta: Meta{
+				Version:         NewVersion(0),
+				CreatedAt:       time.Now(),
+				ExpiredDuration: l.policy.TTL(expiration),
+			},
+			Absent: true,
+		})
+	} else if !l.policy.ReadOnly {
+		err = l.backend.Delete(key)
+	}
+	if err == nil && l.next != nil {
+		// 先提交写回队列中的写入，避免覆盖标记
+		if err = l.Flush(ctx, key); err == nil {
+			err = l.next.SetAbsentCtx(ctx, key, expiration)
+		}
+	}
+	return err
+}
+
+func (l *Level) IsAbsent(key string) bool {
+	return l.IsAbsentCtx(context.Background(), key)
+}
+
+func (l *Level) IsAbsentCtx(ctx context.Context, key string) bool {
+	e, has := l.get(ctx, key)
+	if has {
+		return false
+	}
+	if e != nil && e.Absent {
+		return true
+	}
+	return l.forward(key, e) && l.next.IsAbsentCtx(ctx, key)
+}
+
+func (l *Level) GetOrLoad(key string, dst interface{}, loader LoaderFunc, ttl time.Duration) error {
+	return l.GetOrLoadCtx(context.Background(), key, dst, loader, ttl)
+}
+
+func (l *Level) GetOrLoadCtx(ctx context.Context, key string, dst interface{}, loader LoaderFunc, ttl time.Duration) error {
+	return GetOrLoad(ctx, l.self, key, dst, loader, ttl, l.load)
+}
+
+func (l *Level) Next() Cache {
+	return l.next
+}
+
+func (l *Level) SetNext(next Cache) {
+	l.next = next
+}
+
+func (l *Level) SetPolicy(policy Policy) {
+	l.policy = policy
+}
+
+func (l *Level) Previous() Cache {
+	return l.previous
+}
+
+func (l *Level) SetPrevious(previous Cache) {
+	l.previous = previous
+}
+
+func (l *Level) RemoteSupport() bool {
+	return false
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"context"
+	"github.com/iamdanielyin/cache/json"
+	"github.com/pkg/errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type LoaderFunc func(ctx context.Context) (interface{}, error)
+
+// ErrAbsent 由 LoaderFunc 返回表示数据不存在，开启 AbsentTTL 时会写入不存在的标记
+var ErrAbsent = errors.New(`cache: key is absent`)
+
+type LoadOptions struct {
+	// 加载失败时错误的缓存时长，为 0 时不缓存
+	ErrorTTL time.Duration
+	// Beta 大于 0 时按 XFetch 算法在过期前提前重新加载，越大越早，通常取 1
+	Beta float64
+	// AbsentTTL 加载返回 ErrAbsent 时不存在标记的有效时长，为 0 时不写入
+	AbsentTTL time.Duration
+}
+
+func ParseLoadOptions(m map[string]interface{}) LoadOptions {
+	return LoadOptions{
+		ErrorTTL:  DurationOption(m, "load_error_ttl"),
+		Beta:      FloatOption(m, "load_xfetch_beta"),
+		AbsentTTL: DurationOption(m, "load_absent_ttl"),
+	}
+}
+
+type loadKey struct {
+	head Cache
+	key  string
+}
+
+type loadCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+type loadError struct {
+	err       error
+	expiredAt time.Time
+}
+
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[loadKey]*loadCall
+	errs  map[loadKey]*loadError
+}
+
+var loads = &loadGroup{
+	calls: make(map[loadKey]*loadCall),
+	errs:  make(map[loadKey]*loadError),
+}
+
+// do 合并对同一 key 的并发加载，shared 为 true 表示由其他调用方加载；
+// 等待的调用方在 ctx 结束时直接返回，首个调用方的 ctx 被取消时由等待的调用方重新加载
+func (g *loadGroup) do(ctx context.Context, k loadKey, errTTL time.Duration, fn func() (interface{}, error)) (v interface{}, shared bool, err error) {
+	for {
+		g.mu.Lock()
+		if e, ok := g.errs[k]; ok {
+			if time.Now().Before(e.expiredAt) {
+				g.mu.Unlock()
+				return nil, true, e.err
+			}
+			delete(g.errs, k)
+		}
+		c, ok := g.calls[k]
+		if !ok {
+			break
+		}
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+		if !contextError(c.err) || ctx.Err() != nil {
+			return c.val, true, c.err
+		}
+	}
+	c := &loadCall{done: make(chan struct{})}
+	g.calls[k] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, k)
+		// ctx 被取消或超时不是加载本身的错误，不缓存
+		if c.err != nil && errTTL > 0 && !contextError(c.err) {
+			g.errs[k] = &loadError{err: c.err, expiredAt: time.Now().Add(errTTL)}
+		}
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.val, c.err = fn()
+	return c.val, false, c.err
+}
+
+func contextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// early 按 XFetch 算法判断是否提前重新加载：加载耗时 × beta × -ln(rand) 不小于剩余有效时长时返回 true；
+// 加载耗时随值一同保存，未记录耗时或未设置过期时间时返回 false
+func early(meta *Meta, beta float64) bool {
+	ttl := meta.TTL()
+	if meta.Delta <= 0 || ttl <= 0 {
+		return false
+	}
+	return float64(meta.Delta)*beta*-math.Log(1-rand.Float64()) >= float64(ttl)
+}
+
+// chainHead 返回缓存链的首级，同一条链上的各级共享加载请求
+func chainHead(c Cache) Cache {
+	for c.Previous() != nil {
+		c = c.Previous()
+	}
+	return c
+}
+
+// GetOrLoad 在缓存未命中时调用 loader 加载数据并写入缓存，同一进程内对同一缓存链、同一 key 的并发加载会被合并；
+// opts.Beta 大于 0 时命中的调用方也可能在过期前提前重新加载，其余调用方继续读取缓存
+func GetOrLoad(ctx context.Context, c Cache, key string, dst interface{}, loader LoaderFunc, ttl time.Duration, opts LoadOptions) error {
+	k := loadKey{head: chainHead(c), key: key}
+	load := func() (interface{}, error) {
+		start := time.Now()
+		v, err := loader(ctx)
+		if errors.Is(err, ErrAbsent) && opts.AbsentTTL > 0 {
+			_ = c.SetAbsentCtx(ctx, key, opts.AbsentTTL)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opts.Beta > 0 {
+			// 记录加载耗时，供各节点计算提前加载的概率
+			_ = c.SetWithOptionsCtx(ctx, key, v, SetOptions{Expiration: ttl, Delta: time.Since(start)})
+		} else {
+			_ = c.SetCtx(ctx, key, v, ttl)
+		}
+		return v, nil
+	}
+
+	var hit, refresh bool
+	if opts.Beta > 0 {
+		// 命中时从同一次读取的元数据判断是否提前加载
+		meta, ok := c.HasGetMetaCtx(ctx, key, dst)
+		hit, refresh = ok, ok && early(meta, opts.Beta)
+	} else {
+		hit = c.HasGetCtx(ctx, key, dst)
+	}
+	if hit {
+		if !refresh {
+			return nil
+		}
+		// 提前加载失败时仍返回已读取的值
+		if v, shared, err := loads.do(ctx, k, 0, load); err == nil {
+			_ = decodeLoaded(ctx, c, key, v, shared, dst)
+		}
+		return nil
+	}
+	if opts.AbsentTTL > 0 && c.IsAbsentCtx(ctx, key) {
+		return ErrAbsent
+	}
+	// cached 为 true 表示本调用方加载前已从缓存读取到 dst
+	var cached bool
+	v, shared, err := loads.do(ctx, k, opts.ErrorTTL, func() (interface{}, error) {
+		// 等待期间可能已被其他调用方写入
+		if c.HasGetCtx(ctx, key, dst) {
+			cached = true
+			return dst, nil
+		}
+		return load()
+	})
+	if err != nil || cached {
+		return err
+	}
+	return decodeLoaded(ctx, c, key, v, shared, dst)
+}
+
+// decodeLoaded 合并的调用方各自从缓存读取到自己的 dst，不共用加载方的值；缓存中没有时（如未写入）复制加载的值
+func decodeLoaded(ctx context.Context, c Cache, key string, v interface{}, shared bool, dst interface{}) error {
+	if shared && c.HasGetCtx(ctx, key, dst) {
+		return nil
+	}
+	return json.Copy(v, dst)
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Meta 缓存值的元数据
+type Meta struct {
+	Version         int64
+	CreatedAt       time.Time
+	ExpiredDuration time.Duration
+	// SoftDuration 软过期时长，超过后仍可读取但需要刷新，为 0 时不启用
+	SoftDuration time.Duration
+	// Delta 写入前重新计算该值的耗时，用于提前加载
+	Delta time.Duration
+}
+
+// Stale 是否已超过软过期时间
+func (m *Meta) Stale() bool {
+	return m.SoftDuration > 0 && time.Now().After(m.CreatedAt.Add(m.SoftDuration))
+}
+
+// TTL 返回剩余有效时长，未设置过期时间时返回 0
+func (m *Meta) TTL() time.Duration {
+	if m.ExpiredDuration <= 0 {
+		return 0
+	}
+	return time.Until(m.CreatedAt.Add(m.ExpiredDuration))
+}
+
+var lastVersion int64
+
+// NewVersion 生成一个大于 prev 的新版本号，每次写入都会产生新版本；
+// 以微秒为基数，保证版本号不超过 2^53，Redis 的 Lua 脚本按 double 解析时不丢失精度
+func NewVersion(prev int64) int64 {
+	v := time.Now().UnixMicro()
+	for {
+		last := atomic.LoadInt64(&lastVersion)
+		if v <= last {
+			v = last + 1
+		}
+		if v <= prev {
+			v = prev + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastVersion, last, v) {
+			return v
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrReadOnly = errors.New(`cache: level is read-only`)
+
+// Policy 单个层级的读写策略，零值表示读穿透、写穿透并在读取时回填
+type Policy struct {
+	// ReadOnly 写入、删除及回填都不作用于本级，只传递给下一级；作为最后一级时原子操作返回 ErrReadOnly
+	ReadOnly bool
+	// WriteAround 写入跳过本级并删除本级的旧值，本级只在读取时填充；没有下一级时忽略
+	WriteAround bool
+	// NoPopulate 读取下一级命中后不回填本级
+	NoPopulate bool
+	// MaxTTL 本级保存数据的最长时间，未设置过期时间的数据同样按 MaxTTL 过期
+	MaxTTL time.Duration
+	// TTLFraction 本级过期时间占写入或下一级过期时间的比例，取值 (0, 1)，为 0 时不缩放
+	TTLFraction float64
+	// Jitter 在缩放及限制后的过期时间上随机减少一段时长，避免同批写入的 key 同时过期
+	Jitter *Jitter
+}
+
+// Jitter 过期时间的随机抖动，Percent 与 Range 同时设置时取较大者，最多减少过期时间的一半
+type Jitter struct {
+	// Percent 最多减少过期时间的比例，取值 (0, 1)
+	Percent float64
+	// Range 最多减少的时长
+	Range time.Duration
+	// Seed 不为 0 时使用固定的随机数种子，便于测试复现
+	Seed int64
+
+	once sync.Once
+	mu   sync.Mutex
+	rnd  *rand.Rand
+}
+
+// Apply 返回随机减少后的过期时间，exp 不大于 0 时原样返回
+func (j *Jitter) Apply(exp time.Duration) time.Duration {
+	if j == nil || exp <= 0 {
+		return exp
+	}
+	max := j.Range
+	if d := time.Duration(float64(exp) * j.Percent); d > max {
+		max = d
+	}
+	if max > exp/2 {
+		max = exp / 2
+	}
+	if max <= 0 {
+		return exp
+	}
+	return exp - time.Duration(j.int63n(int64(max)))
+}
+
+func (j *Jitter) int63n(n int64) int64 {
+	if j.Seed == 0 {
+		return rand.Int63n(n)
+	}
+	j.once.Do(func() {
+		j.rnd = rand.New(rand.NewSource(j.Seed))
+	})
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.rnd.Int63n(n)
+}
+
+// Populate 读取下一级命中后是否回填本级
+func (p Policy) Populate() bool {
+	return !p.ReadOnly && !p.NoPopulate
+}
+
+// Stores 写入时是否保存到本级，hasNext 为本级是否有下一级
+func (p Policy) Stores(hasNext bool) bool {
+	if p.ReadOnly {
+		return false
+	}
+	return !p.WriteAround || !hasNext
+}
+
+// TTL 计算本级保存数据的过期时间，依次按 TTLFraction 缩放、按 MaxTTL 限制、按 Jitter 随机减少
+func (p Policy) TTL(exp time.Duration) time.Duration {
+	if exp > 0 && p.TTLFraction > 0 && p.TTLFraction < 1 {
+		if exp = time.Duration(float64(exp) * p.TTLFraction); exp <= 0 {
+			exp = time.Millisecond
+		}
+	}
+	if p.MaxTTL > 0 && (exp <= 0 || exp > p.MaxTTL) {
+		exp = p.MaxTTL
+	}
+	return p.Jitter.Apply(exp)
+}
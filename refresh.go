@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RefreshFunc 按 key 重新加载数据
+type RefreshFunc func(ctx context.Context, key string) (interface{}, error)
+
+type refresher struct {
+	prefix string
+	fn     RefreshFunc
+	opts   *SetOptions
+}
+
+type refreshGroup struct {
+	mu      sync.Mutex
+	loaders map[Cache][]*refresher
+	running map[loadKey]bool
+}
+
+var refreshes = &refreshGroup{
+	loaders: make(map[Cache][]*refresher),
+	running: make(map[loadKey]bool),
+}
+
+// SetOptions SetWithOptions 的写入选项
+type SetOptions struct {
+	// Expiration 过期时间，为 0 时不过期
+	Expiration time.Duration
+	// SoftTTL 软过期时间，超过后值仍可读取，同时在后台通过 RegisterRefresh 注册的函数刷新；为 0 时不开启
+	SoftTTL time.Duration
+	// Delta 重新计算的耗时，供其他节点按 XFetch 算法计算提前加载的概率
+	Delta time.Duration
+}
+
+// RegisterRefresh 为 c 所在的缓存链注册以 prefix 开头的 key 的刷新函数，较长的 prefix 优先；
+// opts 为刷新后写入的过期时间及软过期时间，为 nil 时沿用原值的设置
+func RegisterRefresh(c Cache, prefix string, fn RefreshFunc, opts *SetOptions) {
+	head := chainHead(c)
+	refreshes.mu.Lock()
+	defer refreshes.mu.Unlock()
+
+	list := refreshes.loaders[head]
+	for i, r := range list {
+		if r.prefix == prefix {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	list = append(list, &refresher{prefix: prefix, fn: fn, opts: opts})
+	refreshes.loaders[head] = list
+}
+
+func UnregisterRefresh(c Cache, prefix string) {
+	head := chainHead(c)
+	refreshes.mu.Lock()
+	defer refreshes.mu.Unlock()
+
+	list := refreshes.loaders[head]
+	for i, r := range list {
+		if r.prefix == prefix {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(refreshes.loaders, head)
+	} else {
+		refreshes.loaders[head] = list
+	}
+}
+
+// Revalidate 由驱动在读到值时调用，值超过软过期时间时在后台刷新，同一缓存链的同一 key 同时只刷新一次
+func Revalidate(c Cache, key string, meta *Meta) {
+	if meta == nil || !meta.Stale() {
+		return
+	}
+	head := chainHead(c)
+	k := loadKey{head: head, key: key}
+
+	refreshes.mu.Lock()
+	var match *refresher
+	for _, r := range refreshes.loaders[head] {
+		if strings.HasPrefix(key, r.prefix) && (match == nil || len(r.prefix) > len(match.prefix)) {
+			match = r
+		}
+	}
+	if match == nil || refreshes.running[k] {
+		refreshes.mu.Unlock()
+		return
+	}
+	refreshes.running[k] = true
+	refreshes.mu.Unlock()
+
+	opts := SetOptions{Expiration: meta.ExpiredDuration, SoftTTL: meta.SoftDuration}
+	if match.opts != nil {
+		opts = *match.opts
+	}
+	go func() {
+		defer func() {
+			refreshes.mu.Lock()
+			delete(refreshes.running, k)
+			refreshes.mu.Unlock()
+		}()
+
+		ctx := context.Background()
+		if v, err := match.fn(ctx, key); err == nil {
+			_ = head.SetWithOptionsCtx(ctx, key, v, opts)
+		}
+	}()
+}
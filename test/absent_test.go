@@ -0,0 +1,123 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/iamdanielyin/cache"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAbsent(t *testing.T) {
+	t.Run("miss", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		inst := newPolicyChain(t, cache.Policy{}, cache.Policy{}, store)
+		defer inst.Close()
+
+		if err := inst.SetAbsent("k", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if !inst.IsAbsent("k") || !store.IsAbsent("k") {
+			t.Fatal("absent marker not written")
+		}
+		// 绕过本级直接写入下一级，标记过期前仍不读取下一级
+		_ = store.Set("k", 1)
+		if inst.Has("k") {
+			t.Fatal("Has reported an absent key")
+		}
+		if v, ok := inst.HasGetInt("k"); ok {
+			t.Fatalf("HasGetInt = %d, want miss", v)
+		}
+		var dst int
+		if inst.HasGet("k", &dst) {
+			t.Fatal("HasGet reported an absent key")
+		}
+		if found, _ := inst.MGet(map[string]interface{}{"k": new(int)}); len(found) != 0 {
+			t.Fatalf("MGet found %v", found)
+		}
+
+		// 写入清除标记
+		if err := inst.Set("k", 2); err != nil {
+			t.Fatal(err)
+		}
+		if inst.IsAbsent("k") {
+			t.Fatal("Set left the absent marker")
+		}
+		if v := inst.GetInt("k"); v != 2 {
+			t.Fatalf("k = %d, want 2", v)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		inst, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		defer inst.Close()
+
+		_ = inst.Set("k", 1, time.Hour)
+		_ = inst.SetAbsent("k", 20*time.Millisecond)
+		if inst.Has("k") {
+			t.Fatal("Has reported an absent key")
+		}
+		time.Sleep(30 * time.Millisecond)
+		if inst.IsAbsent("k") || inst.Has("k") {
+			t.Fatal("absent marker outlived its ttl")
+		}
+	})
+
+	t.Run("invalidation", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		b := &broker{}
+		a := newChainNode(t, "a", 1, store, b)
+		c := newChainNode(t, "c", 1, store, b)
+		defer a.Close()
+		defer c.Close()
+
+		if err := a.SetAbsent("u", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Set("u", 1); err != nil {
+			t.Fatal(err)
+		}
+		// 其他节点写入后广播的失效消息清除本地的标记
+		if a.IsAbsent("u") {
+			t.Fatal("invalidation left the absent marker")
+		}
+		if v := a.GetInt("u"); v != 1 {
+			t.Fatalf("u = %d, want 1", v)
+		}
+
+		_ = a.SetAbsent("u", time.Minute)
+		if err := c.Del("u"); err != nil {
+			t.Fatal(err)
+		}
+		if a.IsAbsent("u") {
+			t.Fatal("invalidation left the absent marker")
+		}
+	})
+
+	t.Run("load", func(t *testing.T) {
+		inst, err := cache.NewCache(&cache.Config{
+			Driver:  "memory",
+			Options: map[string]interface{}{"load_absent_ttl": time.Minute},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer inst.Close()
+
+		var calls int32
+		loader := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, cache.ErrAbsent
+		}
+		for i := 0; i < 3; i++ {
+			var dst string
+			if err := inst.GetOrLoad("missing", &dst, loader, time.Hour); !errors.Is(err, cache.ErrAbsent) {
+				t.Fatalf("GetOrLoad err = %v, want ErrAbsent", err)
+			}
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Fatalf("loader called %d times, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"fmt"
+	"github.com/iamdanielyin/cache"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBloomFilter(t *testing.T) {
+	f := cache.NewBloomFilter(cache.BloomFilterOptions{Capacity: 1000, FPRate: 0.01})
+	for i := 0; i < 1000; i++ {
+		f.Add(fmt.Sprintf("k%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		if key := fmt.Sprintf("k%d", i); !f.MayContain(key) {
+			t.Fatalf("%s missing from filter", key)
+		}
+	}
+	var fp int
+	for i := 0; i < 10000; i++ {
+		if f.MayContain(fmt.Sprintf("x%d", i)) {
+			fp++
+		}
+	}
+	if fp > 300 {
+		t.Fatalf("false positives = %d/10000, want about 1%%", fp)
+	}
+
+	// 重建后只保留现有的 key，重建期间的写入不会丢失
+	err := f.Rebuild(func(add func(key string)) error {
+		add("k0")
+		f.Add("late")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.MayContain("k0") || !f.MayContain("late") {
+		t.Fatal("rebuild lost a key")
+	}
+	var stale int
+	for i := 1; i < 1000; i++ {
+		if f.MayContain(fmt.Sprintf("k%d", i)) {
+			stale++
+		}
+	}
+	if stale > 10 {
+		t.Fatalf("%d removed keys still in filter after rebuild", stale)
+	}
+
+	var none *cache.BloomFilter
+	if !none.MayContain("k") {
+		t.Fatal("nil filter must not report misses")
+	}
+}
+
+func TestLevelDBBloomFilter(t *testing.T) {
+	options := map[string]interface{}{
+		"path":                  t.TempDir(),
+		"persist":               true,
+		"bloom_filter":          true,
+		"bloom_filter_capacity": 1000,
+	}
+	inst := newLevelDBCache(t, options)
+	_ = inst.Set("a", 1)
+	_ = inst.MSet(map[string]interface{}{"b": 2, "c": 3}, time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := inst.Incr("n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := inst.GetInt("n"); v != 2 {
+		t.Fatalf("n = %d, want 2", v)
+	}
+	if inst.Has("missing") {
+		t.Fatal("Has reported a key that was never written")
+	}
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开时按已有的 key 重建
+	inst = newLevelDBCache(t, options)
+	defer inst.Close()
+	for key, want := range map[string]int{"a": 1, "b": 2, "c": 3, "n": 2} {
+		if v, ok := inst.HasGetInt(key); !ok || v != want {
+			t.Fatalf("%s = %d, %v, want %d", key, v, ok, want)
+		}
+	}
+}
+
+func TestChainBloomFilter(t *testing.T) {
+	var (
+		reads int32
+		b     = new(broker)
+		store = newMemoryCache(t, nil)
+	)
+	inst, err := cache.NewMultiLevelCache([]cache.Config{
+		{Driver: "ldb", Options: map[string]interface{}{"path": t.TempDir(), "bloom_filter": true}},
+		{Driver: "fake_remote", Options: map[string]interface{}{"store": store, "broker": b, "node_id": "a", "reads": &reads}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	other, err := cache.NewMultiLevelCache([]cache.Config{
+		{Driver: "memory"},
+		{Driver: "fake_remote", Options: map[string]interface{}{"store": store, "broker": b, "node_id": "b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	// 没有写入过的 key 不读取下一级
+	if inst.Has("missing") || inst.HasGet("missing", new(string)) || inst.IsAbsent("missing") {
+		t.Fatal("unwritten key reported as present")
+	}
+	if _, ok := inst.HasGetInt("missing"); ok {
+		t.Fatal("HasGetInt reported an unwritten key")
+	}
+	if _, ok := inst.HasGetString("missing"); ok {
+		t.Fatal("HasGetString reported an unwritten key")
+	}
+	if _, ok := inst.HasGetMeta("missing", new(string)); ok {
+		t.Fatal("HasGetMeta reported an unwritten key")
+	}
+	if found, err := inst.MGet(map[string]interface{}{"missing": new(string), "missing2": new(int)}); err != nil || len(found) != 0 {
+		t.Fatalf("MGet = %v, %v", found, err)
+	}
+	if n := atomic.LoadInt32(&reads); n != 0 {
+		t.Fatalf("next level read %d times for unwritten keys", n)
+	}
+
+	// 本级写入后删除本地的值，仍然读取下一级
+	if err := inst.Set("k", 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inst.Incr("n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inst.Evict("k"); err != nil {
+		t.Fatal(err)
+	}
+	if v := inst.GetInt("k"); v != 1 {
+		t.Fatalf("k = %d, want 1", v)
+	}
+	if v := inst.GetInt("n"); v != 1 {
+		t.Fatalf("n = %d, want 1", v)
+	}
+
+	// 其他节点写入的 key 通过失效消息记录到过滤器
+	if err := other.Set("remote", "v", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v := inst.GetString("remote"); v != "v" {
+		t.Fatalf("remote = %q, want v", v)
+	}
+}
@@ -1,13 +1,20 @@
 package test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
 	"github.com/iamdanielyin/cache"
 	_ "github.com/iamdanielyin/cache/driver/ldb"
 	_ "github.com/iamdanielyin/cache/driver/redis"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -53,3 +60,551 @@ func TestNewMultiLevelCache(t *testing.T) {
 	}
 	t.Log(inst.GetString("foo1"))
 }
+
+func TestTyped(t *testing.T) {
+	inst, err := cache.NewCache(&cache.Config{
+		Driver: "ldb",
+		Options: map[string]interface{}{
+			"path": t.TempDir(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	type user struct {
+		ID   int
+		Name string
+	}
+	users := cache.NewTyped[user](inst)
+	if err := users.Set("user:1", user{ID: 1, Name: "foo"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, has := users.Get("user:1"); !has || v.Name != "foo" {
+		t.Fatalf("unexpected value: %v %v", v, has)
+	}
+	if _, has := users.Get("user:2"); has {
+		t.Fatal("unexpected hit")
+	}
+	if v := users.GetOrDefault("user:2", user{ID: 2}); v.ID != 2 {
+		t.Fatalf("unexpected default: %v", v)
+	}
+	// 无法解码为 T 的值视为未命中
+	_ = inst.Set("user:3", "not a user")
+	if v, has := users.Get("user:3"); has {
+		t.Fatalf("undecodable value reported as hit: %v", v)
+	}
+}
+
+func TestGetOrLoad(t *testing.T) {
+	inst, err := cache.NewCache(&cache.Config{
+		Driver: "ldb",
+		Options: map[string]interface{}{
+			"path":           t.TempDir(),
+			"load_error_ttl": "1m",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	var (
+		calls int32
+		wg    sync.WaitGroup
+	)
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "bar", nil
+	}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v string
+			if err := inst.GetOrLoad("foo", &v, loader, time.Minute); err != nil || v != "bar" {
+				t.Errorf("unexpected result: %q %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("loader called %d times", calls)
+	}
+
+	errLoad := errors.New("load failed")
+	failing := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errLoad
+	}
+	var v string
+	for i := 0; i < 3; i++ {
+		if err := inst.GetOrLoad("missing", &v, failing, time.Minute); err != errLoad {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("loader error not cached, calls: %d", calls)
+	}
+
+	// ctx 被取消的错误不缓存，等待的调用方在自己的 ctx 结束时返回
+	release := make(chan struct{})
+	blocking := func(ctx context.Context) (interface{}, error) {
+		<-release
+		return nil, ctx.Err()
+	}
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- inst.GetOrLoadCtx(leaderCtx, "canceled", new(string), blocking, time.Minute)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	waiterCtx, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	if err := inst.GetOrLoadCtx(waiterCtx, "canceled", new(string), blocking, time.Minute); err != context.DeadlineExceeded {
+		t.Fatalf("waiter error = %v, want DeadlineExceeded", err)
+	}
+	cancel()
+	close(release)
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("leader error = %v, want Canceled", err)
+	}
+	if err := inst.GetOrLoad("canceled", &v, loader, time.Minute); err != nil || v != "bar" {
+		t.Fatalf("canceled load cached: %q %v", v, err)
+	}
+
+	// 加载的值与 dst 类型相同且不可比较时返回解码错误，不会 panic
+	err = inst.GetOrLoad("map", map[string]int{}, func(ctx context.Context) (interface{}, error) {
+		return map[string]int{"a": 1}, nil
+	}, time.Minute)
+	if err == nil {
+		t.Fatal("decoding into a non-pointer dst succeeded")
+	}
+}
+
+func TestGetOrLoadXFetch(t *testing.T) {
+	for _, beta := range []float64{0, 1e6} {
+		inst, err := cache.NewCache(&cache.Config{
+			Driver: "ldb",
+			Options: map[string]interface{}{
+				"path":             t.TempDir(),
+				"load_xfetch_beta": beta,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var calls int32
+		loader := func(ctx context.Context) (interface{}, error) {
+			n := atomic.AddInt32(&calls, 1)
+			time.Sleep(20 * time.Millisecond)
+			return fmt.Sprintf("v%d", n), nil
+		}
+		var v string
+		for i := 0; i < 2; i++ {
+			if err := inst.GetOrLoad("hot", &v, loader, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+		meta, _ := inst.HasGetMeta("hot", new(string))
+		_ = inst.Close()
+
+		if beta == 0 {
+			// 未开启时命中不会重新加载
+			if calls != 1 || v != "v1" {
+				t.Fatalf("beta=0: calls=%d v=%q, want 1 v1", calls, v)
+			}
+			if meta.Delta != 0 {
+				t.Fatalf("beta=0: delta = %v, want 0", meta.Delta)
+			}
+			continue
+		}
+		// 加载耗时远大于剩余时长 / beta，命中后提前重新加载
+		if calls != 2 || v != "v2" {
+			t.Fatalf("beta=%v: calls=%d v=%q, want 2 v2", beta, calls, v)
+		}
+		if meta.Delta < 20*time.Millisecond {
+			t.Fatalf("beta=%v: delta = %v, want >= 20ms", beta, meta.Delta)
+		}
+	}
+}
+
+func TestMultiGetSet(t *testing.T) {
+	inst, err := cache.NewCache(&cache.Config{
+		Driver: "ldb",
+		Options: map[string]interface{}{
+			"path": t.TempDir(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	values := cache.NewTyped[int](inst)
+	if err := values.MSet(map[string]int{"a": 1, "b": 2, "c": 3}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	found, err := values.MGet("a", "b", "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found["a"] != 1 || found["b"] != 2 {
+		t.Fatalf("unexpected values: %v", found)
+	}
+	if err := inst.MDel("a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if inst.Has("a") || inst.Has("c") || !inst.Has("b") {
+		t.Fatal("unexpected keys after MDel")
+	}
+}
+
+// 本地各级依次未命中时读取下一级，命中的值回填到之前的各级
+func TestMultiGetFallThrough(t *testing.T) {
+	store := newMemoryCache(t, nil)
+	inst, err := cache.NewMultiLevelCache([]cache.Config{
+		{Driver: "memory"},
+		{Driver: "ldb", Options: map[string]interface{}{"path": t.TempDir()}},
+		{Driver: "fake_remote", Options: map[string]interface{}{"store": store, "broker": &broker{}, "node_id": "a"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	mid := inst.Next()
+
+	// a 只在最后一级，b 只在第二级，c 只在第一级，d 各级都没有
+	_ = store.Set("a", 1)
+	_ = inst.Set("b", 2)
+	_ = inst.Evict("b")
+	_ = store.Del("b")
+	_ = inst.Set("c", 3)
+	_ = mid.Evict("c")
+	_ = store.Del("c")
+
+	dst := map[string]interface{}{"a": new(int), "b": new(int), "c": new(int), "d": new(int)}
+	found, err := inst.MGet(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || *dst["a"].(*int) != 1 || *dst["b"].(*int) != 2 || *dst["c"].(*int) != 3 {
+		t.Fatalf("unexpected values: %v", found)
+	}
+	usage := func(c cache.Cache) int {
+		n, _ := c.(interface{ Usage() (int, int64) }).Usage()
+		return n
+	}
+	if n := usage(inst); n != 3 {
+		t.Fatalf("first level entries = %d, want a, b and c", n)
+	}
+	if n := usage(mid); n != 2 {
+		t.Fatalf("second level entries = %d, want a and b", n)
+	}
+	if n := usage(store); n != 1 {
+		t.Fatalf("last level entries = %d, want only a", n)
+	}
+}
+
+// 无法解码的值视为本级未命中，不影响同一批次的其他 key，并从下一级读取后回填
+func TestMultiGetCorrupt(t *testing.T) {
+	for _, driver := range []string{"memory", "ldb"} {
+		t.Run(driver, func(t *testing.T) {
+			store := newMemoryCache(t, nil)
+			inst, err := cache.NewMultiLevelCache([]cache.Config{
+				{Driver: driver, Options: map[string]interface{}{"path": t.TempDir()}},
+				{Driver: "fake_remote", Options: map[string]interface{}{"store": store, "broker": &broker{}, "node_id": "a"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer inst.Close()
+
+			// b、c 在本级无法解码为 int，c 在下一级也无法解码
+			_ = inst.Set("a", 1)
+			_ = inst.Set("b", "x")
+			_ = store.Set("b", 2)
+			_ = inst.Set("c", "x")
+
+			dst := map[string]interface{}{"a": new(int), "b": new(int), "c": new(int)}
+			found, err := inst.MGet(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := found["c"]; ok || len(found) != 2 || *dst["a"].(*int) != 1 || *dst["b"].(*int) != 2 {
+				t.Fatalf("unexpected values: %v", found)
+			}
+			_ = store.Del("b")
+			if v, ok := inst.HasGetInt("b"); !ok || v != 2 {
+				t.Fatalf("b not backfilled: %d, %v", v, ok)
+			}
+
+			// 单个 key 的读取与批量读取一致
+			_ = inst.Set("d", "x")
+			_ = store.Set("d", 4)
+			var d int
+			if !inst.HasGet("d", &d) || d != 4 {
+				t.Fatalf("HasGet = %d, want 4 from the next level", d)
+			}
+
+			// 按类型读取时同样视为本级未命中
+			_ = inst.Set("e", "x")
+			_ = store.Set("e", 5)
+			if v, ok := inst.HasGetInt("e"); !ok || v != 5 {
+				t.Fatalf("HasGetInt = %d, %v, want 5 from the next level", v, ok)
+			}
+		})
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	inst, err := cache.NewCache(&cache.Config{
+		Driver: "ldb",
+		Options: map[string]interface{}{
+			"path": t.TempDir(),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+
+	if ok, err := inst.SetIfPresent("counter", 1); err != nil || ok {
+		t.Fatalf("SetIfPresent on missing key: %v %v", ok, err)
+	}
+	if ok, err := inst.SetIfAbsent("counter", 1); err != nil || !ok {
+		t.Fatalf("SetIfAbsent on missing key: %v %v", ok, err)
+	}
+	if ok, err := inst.SetIfAbsent("counter", 2); err != nil || ok {
+		t.Fatalf("SetIfAbsent on existing key: %v %v", ok, err)
+	}
+
+	var v int
+	meta, has := inst.HasGetMeta("counter", &v)
+	if !has || v != 1 {
+		t.Fatalf("unexpected value: %v %v", v, has)
+	}
+	if ok, err := inst.CompareAndSwap("counter", meta.Version, v+1); err != nil || !ok {
+		t.Fatalf("CompareAndSwap with current version: %v %v", ok, err)
+	}
+	if ok, err := inst.CompareAndSwap("counter", meta.Version, v+2); err != nil || ok {
+		t.Fatalf("CompareAndSwap with stale version: %v %v", ok, err)
+	}
+	if v := inst.GetInt("counter"); v != 2 {
+		t.Fatalf("unexpected value: %v", v)
+	}
+}
+
+func newRedisMultiLevelCache(t *testing.T, nodeID string, extra map[string]interface{}) cache.Cache {
+	if os.Getenv("REDIS_ADDR") == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	options := map[string]interface{}{
+		"addrs":    []string{os.Getenv("REDIS_ADDR")},
+		"password": os.Getenv("REDIS_PWD"),
+		"db":       2,
+		"node_id":  nodeID,
+	}
+	for k, v := range extra {
+		options[k] = v
+	}
+	inst, err := cache.NewMultiLevelCache([]cache.Config{
+		{
+			Driver: "ldb",
+			Options: map[string]interface{}{
+				"path": t.TempDir(),
+			},
+		},
+		{
+			Driver:  "redis",
+			Options: options,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = inst.Close() })
+	return inst
+}
+
+func TestInvalidateOnSet(t *testing.T) {
+	var (
+		a = newRedisMultiLevelCache(t, "node-a", nil)
+		b = newRedisMultiLevelCache(t, "node-b", nil)
+	)
+	if err := a.Set("invalidate:foo", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v := b.GetString("invalidate:foo"); v != "v1" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+	if err := a.Set("invalidate:foo", "v2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for b.GetString("invalidate:foo") != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("stale value on node b after set on node a")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = a.Del("invalidate:foo")
+}
+
+// INCR 写入的计数器没有封装，Redis 层级及经由本地层级都能读取
+func TestRedisIncr(t *testing.T) {
+	inst := newRedisMultiLevelCache(t, "node-a", nil)
+	remote := inst.Next()
+	_ = inst.Del("incr:n", "incr:f")
+	defer inst.Del("incr:n", "incr:f")
+
+	for i := 0; i < 2; i++ {
+		if _, err := remote.Incr("incr:n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, ok := remote.HasGetInt("incr:n"); !ok || v != 2 {
+		t.Fatalf("redis counter = %d, %v, want 2", v, ok)
+	}
+
+	if v, err := inst.Incr("incr:n"); err != nil || v != 3 {
+		t.Fatalf("Incr = %d, %v, want 3", v, err)
+	}
+	if v, ok := inst.HasGetInt("incr:n"); !ok || v != 3 {
+		t.Fatalf("chain counter = %d, %v, want 3", v, ok)
+	}
+	if _, err := inst.IncrByFloat("incr:f", 1.5); err != nil {
+		t.Fatal(err)
+	}
+	if v := inst.GetFloat("incr:f"); v != 1.5 {
+		t.Fatalf("chain float counter = %v, want 1.5", v)
+	}
+	_ = inst.Evict("incr:n", "incr:f")
+	dst := map[string]interface{}{"incr:n": new(int), "incr:f": new(float64)}
+	if found, err := inst.MGet(dst); err != nil || len(found) != 2 || *dst["incr:n"].(*int) != 3 {
+		t.Fatalf("MGet counters = %v, %v", found, err)
+	}
+}
+
+func TestClientTracking(t *testing.T) {
+	inst := newRedisMultiLevelCache(t, "node-a", map[string]interface{}{"tracking": "default"})
+	if !inst.Next().(interface{ Tracking() bool }).Tracking() {
+		t.Skip("server does not support CLIENT TRACKING")
+	}
+	if err := inst.Set("tracking:foo", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// 经由 redis 读取后该 key 才会被服务端跟踪
+	_ = inst.Evict("tracking:foo")
+	if v := inst.GetString("tracking:foo"); v != "v1" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+
+	// 模拟不经过本库的外部写入
+	rdb := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR"), Password: os.Getenv("REDIS_PWD"), DB: 2})
+	defer rdb.Close()
+	if err := rdb.Set(context.Background(), "tracking:foo", `{"data":"v2"}`, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for inst.GetString("tracking:foo") != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("stale value after external write")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = inst.Del("tracking:foo")
+}
+
+// killPubSub 断开服务端所有订阅连接，模拟网络中断
+func killPubSub(t *testing.T) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR"), Password: os.Getenv("REDIS_PWD"), DB: 2})
+	t.Cleanup(func() { _ = rdb.Close() })
+	if err := rdb.Do(context.Background(), "CLIENT", "KILL", "TYPE", "pubsub").Err(); err != nil {
+		t.Fatal(err)
+	}
+	return rdb
+}
+
+func waitString(t *testing.T, inst cache.Cache, key, want string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for inst.GetString(key) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: want %q, got %q", key, want, inst.GetString(key))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// 订阅失效消息的连接重连后连接 ID 变化，数据连接需按新的 ID 重新开启 CLIENT TRACKING
+func TestClientTrackingReconnect(t *testing.T) {
+	inst := newRedisMultiLevelCache(t, "node-a", map[string]interface{}{"tracking": "default"})
+	if !inst.Next().(interface{ Tracking() bool }).Tracking() {
+		t.Skip("server does not support CLIENT TRACKING")
+	}
+	if err := inst.Set("tracking:bar", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	rdb := killPubSub(t)
+	if err := rdb.Set(context.Background(), "tracking:bar", `{"data":"v2"}`, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	waitString(t, inst, "tracking:bar", "v2")
+	if err := rdb.Set(context.Background(), "tracking:bar", `{"data":"v3"}`, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	waitString(t, inst, "tracking:bar", "v3")
+	_ = inst.Del("tracking:bar")
+}
+
+func TestReconnectFlush(t *testing.T) {
+	inst := newRedisMultiLevelCache(t, "node-a", nil)
+	if err := inst.Set("reconnect:foo", "v1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// 断线期间的外部写入不会产生失效消息
+	rdb := killPubSub(t)
+	if err := rdb.Set(context.Background(), "reconnect:foo", `{"data":"v2"}`, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	waitString(t, inst, "reconnect:foo", "v2")
+	_ = inst.Del("reconnect:foo")
+}
+
+func TestReconnectReplay(t *testing.T) {
+	var (
+		options = map[string]interface{}{"on_reconnect": "replay"}
+		a       = newRedisMultiLevelCache(t, "node-a", options)
+		b       = newRedisMultiLevelCache(t, "node-b", options)
+	)
+	if err := a.MSet(map[string]interface{}{"replay:foo": "v1", "replay:bar": "v1"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	waitString(t, b, "replay:foo", "v1")
+	waitString(t, b, "replay:bar", "v1")
+
+	// 只写入日志而不广播，模拟断线期间错过的消息，重连后只能通过补发得知
+	rdb := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_ADDR"), Password: os.Getenv("REDIS_PWD"), DB: 2})
+	defer rdb.Close()
+	ctx := context.Background()
+	if err := rdb.Set(ctx, "replay:foo", `{"data":"v2"}`, time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	inv := cache.NewInvalidation("node-a", cache.InvalidationSet, "replay:foo")
+	if err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: "CONNECT_CHANNEL:log", Values: map[string]interface{}{"msg": inv.String()}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if v := b.GetString("replay:foo"); v != "v1" {
+		t.Fatalf("replay:foo = %q before reconnect, want v1", v)
+	}
+	killPubSub(t)
+	waitString(t, b, "replay:foo", "v2")
+	// 补发只删除错过的 key，其余本地缓存保留
+	if n, _ := b.(interface{ Usage() (int, int64) }).Usage(); n != 2 {
+		t.Fatalf("unexpected local entries after replay: %d", n)
+	}
+	_ = a.Del("replay:foo", "replay:bar")
+}
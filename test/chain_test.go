@@ -0,0 +1,412 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"github.com/iamdanielyin/cache"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	cache.RegisterDriver(&countingDriver{})
+	cache.RegisterDriver(&fakeRemoteDriver{})
+}
+
+// countingDriver 本地层级，记录 Evict 被调用的次数
+type countingDriver struct{}
+
+func (d *countingDriver) Name() string {
+	return "counting"
+}
+
+func (d *countingDriver) NewCache(m map[string]interface{}) (cache.Cache, error) {
+	inst, err := cache.NewCache(&cache.Config{Driver: "memory"})
+	if err != nil {
+		return nil, err
+	}
+	return &countingCache{Cache: inst, evicts: m["evicts"].(*int32)}, nil
+}
+
+type countingCache struct {
+	cache.Cache
+	evicts *int32
+}
+
+func (c *countingCache) Evict(keys ...string) error {
+	return c.EvictCtx(context.Background(), keys...)
+}
+
+func (c *countingCache) EvictCtx(ctx context.Context, keys ...string) error {
+	atomic.AddInt32(c.evicts, 1)
+	return c.Cache.EvictCtx(ctx, keys...)
+}
+
+// broker 进程内的消息通道，同步分发给所有订阅者
+type broker struct {
+	mu       sync.Mutex
+	handlers []func(string, string)
+}
+
+func (b *broker) publish(channel, message string) {
+	b.mu.Lock()
+	handlers := append([]func(string, string){}, b.handlers...)
+	b.mu.Unlock()
+	for _, handler := range handlers {
+		handler(channel, message)
+	}
+}
+
+func (b *broker) subscribe(handler func(string, string)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+}
+
+// fakeRemoteDriver 模拟各节点共享的远程层级，数据存放在共享的 store 中；
+// 与 redis 驱动一致，只有最后一级在写入后通过 broker 广播失效消息并处理收到的消息
+type fakeRemoteDriver struct{}
+
+func (d *fakeRemoteDriver) Name() string {
+	return "fake_remote"
+}
+
+func (d *fakeRemoteDriver) NewCache(m map[string]interface{}) (cache.Cache, error) {
+	inst := &fakeRemoteCache{
+		Cache:  m["store"].(cache.Cache),
+		broker: m["broker"].(*broker),
+		nodeID: m["node_id"].(string),
+	}
+	inst.reads, _ = m["reads"].(*int32)
+	inst.broker.subscribe(func(channel, data string) {
+		inv, err := cache.ParseInvalidation(data)
+		if err != nil || inst.next != nil || inv.Origin == inst.nodeID || inv.Empty() {
+			return
+		}
+		_ = cache.Invalidate(context.Background(), inst, inv)
+	})
+	return inst, nil
+}
+
+type fakeRemoteCache struct {
+	cache.Cache
+	broker *broker
+	nodeID string
+	// reads 不为 nil 时记录上一级读取本级的次数
+	reads    *int32
+	next     cache.Cache
+	previous cache.Cache
+}
+
+func (c *fakeRemoteCache) read() {
+	if c.reads != nil {
+		atomic.AddInt32(c.reads, 1)
+	}
+}
+
+func (c *fakeRemoteCache) HasCtx(ctx context.Context, key string) bool {
+	c.read()
+	return c.Cache.HasCtx(ctx, key)
+}
+
+func (c *fakeRemoteCache) HasGetCtx(ctx context.Context, key string, dst interface{}) bool {
+	c.read()
+	return c.Cache.HasGetCtx(ctx, key, dst)
+}
+
+func (c *fakeRemoteCache) HasGetIntCtx(ctx context.Context, key string) (int, bool) {
+	c.read()
+	return c.Cache.HasGetIntCtx(ctx, key)
+}
+
+func (c *fakeRemoteCache) HasGetStringCtx(ctx context.Context, key string) (string, bool) {
+	c.read()
+	return c.Cache.HasGetStringCtx(ctx, key)
+}
+
+func (c *fakeRemoteCache) TTLCtx(ctx context.Context, key string) (time.Duration, bool) {
+	c.read()
+	return c.Cache.TTLCtx(ctx, key)
+}
+
+func (c *fakeRemoteCache) MGetCtx(ctx context.Context, dst map[string]interface{}) (map[string]time.Duration, error) {
+	c.read()
+	return c.Cache.MGetCtx(ctx, dst)
+}
+
+func (c *fakeRemoteCache) HasGetMetaCtx(ctx context.Context, key string, dst interface{}) (*cache.Meta, bool) {
+	c.read()
+	return c.Cache.HasGetMetaCtx(ctx, key, dst)
+}
+
+func (c *fakeRemoteCache) IsAbsentCtx(ctx context.Context, key string) bool {
+	c.read()
+	return c.Cache.IsAbsentCtx(ctx, key)
+}
+
+func (c *fakeRemoteCache) Set(key string, value interface{}, expiration ...time.Duration) error {
+	return c.SetCtx(context.Background(), key, value, expiration...)
+}
+
+func (c *fakeRemoteCache) SetCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) error {
+	if err := c.Cache.SetCtx(ctx, key, value, expiration...); err != nil {
+		return err
+	}
+	if c.next != nil {
+		return c.next.SetCtx(ctx, key, value, expiration...)
+	}
+	c.broker.publish("", cache.NewInvalidation(c.nodeID, cache.InvalidationSet, key).String())
+	return nil
+}
+
+func (c *fakeRemoteCache) SetWithOptions(key string, value interface{}, opts cache.SetOptions) error {
+	return c.SetWithOptionsCtx(context.Background(), key, value, opts)
+}
+
+func (c *fakeRemoteCache) SetWithOptionsCtx(ctx context.Context, key string, value interface{}, opts cache.SetOptions) error {
+	if err := c.Cache.SetWithOptionsCtx(ctx, key, value, opts); err != nil {
+		return err
+	}
+	if c.next != nil {
+		return c.next.SetWithOptionsCtx(ctx, key, value, opts)
+	}
+	c.broker.publish("", cache.NewInvalidation(c.nodeID, cache.InvalidationSet, key).String())
+	return nil
+}
+
+func (c *fakeRemoteCache) Del(keys ...string) error {
+	return c.MDelCtx(context.Background(), keys...)
+}
+
+func (c *fakeRemoteCache) DelCtx(ctx context.Context, keys ...string) error {
+	return c.MDelCtx(ctx, keys...)
+}
+
+func (c *fakeRemoteCache) MDel(keys ...string) error {
+	return c.MDelCtx(context.Background(), keys...)
+}
+
+func (c *fakeRemoteCache) MDelCtx(ctx context.Context, keys ...string) error {
+	if err := c.Cache.MDelCtx(ctx, keys...); err != nil {
+		return err
+	}
+	if c.next != nil {
+		return c.next.MDelCtx(ctx, keys...)
+	}
+	c.broker.publish("", cache.NewInvalidation(c.nodeID, cache.InvalidationDel, keys...).String())
+	return nil
+}
+
+func (c *fakeRemoteCache) Next() cache.Cache {
+	return c.next
+}
+
+func (c *fakeRemoteCache) SetNext(next cache.Cache) {
+	c.next = next
+}
+
+func (c *fakeRemoteCache) Previous() cache.Cache {
+	return c.previous
+}
+
+func (c *fakeRemoteCache) SetPrevious(previous cache.Cache) {
+	c.previous = previous
+}
+
+func (c *fakeRemoteCache) Close() error {
+	return nil
+}
+
+func (c *fakeRemoteCache) RemoteSupport() bool {
+	return true
+}
+
+type chainNode struct {
+	cache.Cache
+	evicts []int32
+}
+
+func newChainNode(t *testing.T, nodeID string, locals int, store cache.Cache, b *broker) *chainNode {
+	return newRemoteChainNode(t, nodeID, locals, []cache.Cache{store}, b)
+}
+
+// newRemoteChainNode 创建 locals 个本地层级及每个 store 对应的远程层级，各远程层级的节点 ID 不同
+func newRemoteChainNode(t *testing.T, nodeID string, locals int, stores []cache.Cache, b *broker) *chainNode {
+	node := &chainNode{evicts: make([]int32, locals)}
+	var configs []cache.Config
+	for i := 0; i < locals; i++ {
+		configs = append(configs, cache.Config{
+			Driver:  "counting",
+			Options: map[string]interface{}{"evicts": &node.evicts[i]},
+		})
+	}
+	for i, store := range stores {
+		configs = append(configs, cache.Config{
+			Driver:  "fake_remote",
+			Options: map[string]interface{}{"store": store, "broker": b, "node_id": fmt.Sprintf("%s-%d", nodeID, i)},
+		})
+	}
+	inst, err := cache.NewMultiLevelCache(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.Cache = inst
+	return node
+}
+
+func (n *chainNode) resetEvicts() {
+	for i := range n.evicts {
+		atomic.StoreInt32(&n.evicts[i], 0)
+	}
+}
+
+// localHas 检查各本地层级是否缓存了数据
+func (n *chainNode) localHas() []bool {
+	var has []bool
+	for c := n.Cache; !c.RemoteSupport(); c = c.Next() {
+		entries, _ := c.(*countingCache).Cache.(interface{ Usage() (int, int64) }).Usage()
+		has = append(has, entries > 0)
+	}
+	return has
+}
+
+func TestChainInvalidation(t *testing.T) {
+	for _, levels := range []int{3, 4} {
+		t.Run(fmt.Sprintf("levels=%d", levels), func(t *testing.T) {
+			var (
+				b     = new(broker)
+				store = newMemoryCache(t, nil)
+				a     = newChainNode(t, "node-a", levels-1, store, b)
+				c     = newChainNode(t, "node-c", levels-1, store, b)
+			)
+			if err := a.Set("foo", "v1"); err != nil {
+				t.Fatal(err)
+			}
+			// 逐级回填 node-c 的本地层级
+			if v := c.GetString("foo"); v != "v1" {
+				t.Fatalf("unexpected value: %q", v)
+			}
+			for i, has := range c.localHas() {
+				if !has {
+					t.Fatalf("level %d not populated", i)
+				}
+			}
+			a.resetEvicts()
+			c.resetEvicts()
+
+			if err := a.Set("foo", "v2"); err != nil {
+				t.Fatal(err)
+			}
+			for i := range c.evicts {
+				if n := atomic.LoadInt32(&c.evicts[i]); n != 1 {
+					t.Fatalf("node-c level %d evicted %d times", i, n)
+				}
+				if n := atomic.LoadInt32(&a.evicts[i]); n != 0 {
+					t.Fatalf("origin node level %d evicted %d times", i, n)
+				}
+			}
+			for i, has := range c.localHas() {
+				if has {
+					t.Fatalf("stale value at node-c level %d", i)
+				}
+			}
+			if v := c.GetString("foo"); v != "v2" {
+				t.Fatalf("unexpected value after invalidation: %q", v)
+			}
+
+			c.resetEvicts()
+			if err := a.Del("foo"); err != nil {
+				t.Fatal(err)
+			}
+			for i := range c.evicts {
+				if n := atomic.LoadInt32(&c.evicts[i]); n != 1 {
+					t.Fatalf("node-c level %d evicted %d times after Del", i, n)
+				}
+			}
+			if c.Has("foo") {
+				t.Fatal("unexpected key after Del")
+			}
+		})
+	}
+}
+
+func TestChainInvalidationRemoteLevels(t *testing.T) {
+	var (
+		b      = new(broker)
+		stores = []cache.Cache{newMemoryCache(t, nil), newMemoryCache(t, nil)}
+		a      = newRemoteChainNode(t, "node-a", 1, stores, b)
+		c      = newRemoteChainNode(t, "node-c", 1, stores, b)
+	)
+	_ = a.Set("foo", "v1")
+	if v := c.GetString("foo"); v != "v1" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+	a.resetEvicts()
+	c.resetEvicts()
+
+	// 只有最后一个远程层级处理失效消息，写入的节点不删除自己的本地层级
+	if err := a.Set("foo", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&c.evicts[0]); n != 1 {
+		t.Fatalf("node-c local level evicted %d times, want 1", n)
+	}
+	if n := atomic.LoadInt32(&a.evicts[0]); n != 0 {
+		t.Fatalf("origin node local level evicted %d times, want 0", n)
+	}
+	if v := c.GetString("foo"); v != "v2" {
+		t.Fatalf("unexpected value after invalidation: %q", v)
+	}
+}
+
+// 首级命中且带有最后一级的版本号时 HasGetMeta 不读取下一级；首级自身写入的值没有版本号，读取一次下一级后回填
+func TestChainHasGetMeta(t *testing.T) {
+	for _, driver := range []string{"memory", "ldb"} {
+		t.Run(driver, func(t *testing.T) {
+			var (
+				reads int32
+				store = newMemoryCache(t, nil)
+			)
+			inst, err := cache.NewMultiLevelCache([]cache.Config{
+				{Driver: driver, Options: map[string]interface{}{"path": t.TempDir()}},
+				{Driver: "fake_remote", Options: map[string]interface{}{"store": store, "broker": &broker{}, "node_id": "a", "reads": &reads}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer inst.Close()
+
+			if err := inst.SetWithOptions("hot", "v1", cache.SetOptions{Expiration: time.Minute, Delta: 20 * time.Millisecond}); err != nil {
+				t.Fatal(err)
+			}
+			want, _ := store.HasGetMeta("hot", new(string))
+			var meta *cache.Meta
+			for i := 0; i < 3; i++ {
+				var (
+					v  string
+					ok bool
+				)
+				if meta, ok = inst.HasGetMeta("hot", &v); !ok || v != "v1" {
+					t.Fatalf("HasGetMeta = %q, %v", v, ok)
+				}
+				if meta.Version != want.Version || meta.Delta != want.Delta || meta.TTL() <= 0 {
+					t.Fatalf("meta = %+v, want version %d and delta %v", meta, want.Version, want.Delta)
+				}
+			}
+			if n := atomic.LoadInt32(&reads); n != 1 {
+				t.Fatalf("next level read %d times, want 1", n)
+			}
+
+			// 首级返回的版本号可用于 CompareAndSwap
+			if ok, err := inst.CompareAndSwap("hot", meta.Version, "v2", time.Minute); !ok || err != nil {
+				t.Fatalf("CompareAndSwap = %v, %v", ok, err)
+			}
+			if v := inst.GetString("hot"); v != "v2" {
+				t.Fatalf("value after CompareAndSwap = %q", v)
+			}
+		})
+	}
+}
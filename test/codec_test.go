@@ -0,0 +1,104 @@
+package test
+
+import (
+	"bytes"
+	"github.com/iamdanielyin/cache"
+	"testing"
+	"time"
+)
+
+type codecValue struct {
+	ID      int64
+	Payload []byte
+	At      time.Time
+}
+
+func TestCodec(t *testing.T) {
+	at := time.Date(2021, 6, 1, 12, 0, 0, 123456789, time.FixedZone("CST", 8*3600))
+	want := codecValue{ID: 1<<62 + 1, Payload: []byte{0, 1, 2, 255}, At: at}
+
+	for _, driver := range []string{"memory", "ldb"} {
+		t.Run(driver, func(t *testing.T) {
+			options := func(codec string) map[string]interface{} {
+				return map[string]interface{}{"path": t.TempDir(), "codec": codec}
+			}
+
+			inst, err := cache.NewCache(&cache.Config{Driver: driver, Options: options(cache.CodecGob)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer inst.Close()
+			if err := inst.Set("v", want); err != nil {
+				t.Fatal(err)
+			}
+			var got codecValue
+			if !inst.HasGet("v", &got) || got.ID != want.ID || !bytes.Equal(got.Payload, want.Payload) || !got.At.Equal(at) {
+				t.Fatalf("gob value = %+v, want %+v", got, want)
+			}
+			_ = inst.Set("n", 41)
+			if n, err := inst.Incr("n"); err != nil || n != 42 {
+				t.Fatalf("Incr = %d, %v, want 42", n, err)
+			}
+			if v := inst.GetFloat("n"); v != 42 {
+				t.Fatalf("GetFloat = %v, want 42", v)
+			}
+
+			raw, err := cache.NewCache(&cache.Config{Driver: driver, Options: options(cache.CodecRaw)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer raw.Close()
+			if err := raw.Set("b", []byte("\x00raw")); err != nil {
+				t.Fatal(err)
+			}
+			var b []byte
+			if !raw.HasGet("b", &b) || string(b) != "\x00raw" {
+				t.Fatalf("raw value = %q", b)
+			}
+			if err := raw.Set("n", 1); err != cache.ErrUnsupportedValue {
+				t.Fatalf("raw Set(int) err = %v, want ErrUnsupportedValue", err)
+			}
+
+			if _, err := cache.NewCache(&cache.Config{Driver: driver, Options: options("unknown")}); err == nil {
+				t.Fatal("unknown codec accepted")
+			}
+		})
+	}
+
+	// 切换编码方式后，之前写入的数据按保存的编码方式读取
+	t.Run("mixed", func(t *testing.T) {
+		path := t.TempDir()
+		inst := newLevelDBCache(t, map[string]interface{}{"path": path, "persist": true})
+		_ = inst.Set("old", "json")
+		_ = inst.Close()
+
+		inst = newLevelDBCache(t, map[string]interface{}{"path": path, "persist": true, "codec": cache.CodecGob})
+		defer inst.Close()
+		_ = inst.Set("new", "gob")
+		for key, want := range map[string]string{"old": "json", "new": "gob"} {
+			if v := inst.GetString(key); v != want {
+				t.Fatalf("%s = %q, want %q", key, v, want)
+			}
+		}
+	})
+
+	// 写回时下一级按本级的编码方式保存
+	t.Run("write-back", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		inst, err := cache.NewMultiLevelCache([]cache.Config{
+			{Driver: "memory", Options: map[string]interface{}{"write_back": true, "codec": cache.CodecGob}},
+			{Driver: "fake_remote", Options: map[string]interface{}{"store": store, "broker": &broker{}, "node_id": "a"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = inst.Set("v", want)
+		if err := inst.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var got codecValue
+		if !store.HasGet("v", &got) || got.ID != want.ID || !bytes.Equal(got.Payload, want.Payload) {
+			t.Fatalf("next value = %+v, want %+v", got, want)
+		}
+	})
+}
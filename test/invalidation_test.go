@@ -0,0 +1,61 @@
+package test
+
+import (
+	"github.com/iamdanielyin/cache"
+	"reflect"
+	"testing"
+)
+
+func TestParseInvalidation(t *testing.T) {
+	inv := cache.NewInvalidation("node-a", cache.InvalidationSet, "a,b", "c")
+	inv.Prefixes = []string{"user:"}
+	parsed, err := cache.ParseInvalidation(inv.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Version != cache.InvalidationVersion || parsed.Op != cache.InvalidationSet || parsed.Origin != "node-a" ||
+		!reflect.DeepEqual(parsed.Keys, inv.Keys) || !reflect.DeepEqual(parsed.Prefixes, inv.Prefixes) ||
+		!parsed.Timestamp.Equal(inv.Timestamp) {
+		t.Fatalf("unexpected message: %+v", parsed)
+	}
+
+	for data, want := range map[string]cache.Invalidation{
+		"a,b": {Op: cache.InvalidationDel, Keys: []string{"a", "b"}},
+		"":    {Op: cache.InvalidationDel},
+	} {
+		parsed, err := cache.ParseInvalidation(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*parsed, want) {
+			t.Fatalf("unexpected legacy message %q: %+v", data, parsed)
+		}
+	}
+
+	for _, data := range []string{`{"v":2,"op":"del","keys":["a"]}`, `{"op":"del","keys":["a"]}`} {
+		if _, err := cache.ParseInvalidation(data); err == nil {
+			t.Fatalf("unsupported version accepted: %s", data)
+		}
+	}
+}
+
+func TestEvictPrefix(t *testing.T) {
+	for name, inst := range map[string]cache.Cache{
+		"ldb":    newLevelDBCache(t, map[string]interface{}{"path": t.TempDir()}),
+		"memory": newMemoryCache(t, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer inst.Close()
+
+			if err := inst.MSet(map[string]interface{}{"user:1": 1, "user:2": 2, "order:1": 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := inst.DelPrefix("user:"); err != nil {
+				t.Fatal(err)
+			}
+			if inst.Has("user:1") || inst.Has("user:2") || !inst.Has("order:1") {
+				t.Fatal("unexpected keys after DelPrefix")
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"fmt"
+	"github.com/iamdanielyin/cache"
+	"testing"
+	"time"
+)
+
+func newLevelDBCache(tb testing.TB, options map[string]interface{}) cache.Cache {
+	inst, err := cache.NewCache(&cache.Config{
+		Driver:  "ldb",
+		Options: options,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return inst
+}
+
+func TestLevelDBPersist(t *testing.T) {
+	options := map[string]interface{}{
+		"path":    t.TempDir(),
+		"persist": true,
+	}
+	inst := newLevelDBCache(t, options)
+	if err := inst.Set("foo", "bar", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := inst.Set("short", "lived", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	inst = newLevelDBCache(t, options)
+	if v, has := inst.HasGetString("foo"); !has || v != "bar" {
+		t.Fatalf("unexpected value after reopen: %q %v", v, has)
+	}
+	if found, _ := inst.HasPrefix("short"); len(found) != 0 {
+		t.Fatalf("expired key not purged on reopen: %v", found)
+	}
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(options, "persist")
+	inst = newLevelDBCache(t, options)
+	defer inst.Close()
+	if inst.Has("foo") {
+		t.Fatal("unexpected key without persist")
+	}
+}
+
+func TestLevelDBSweeper(t *testing.T) {
+	inst := newLevelDBCache(t, map[string]interface{}{
+		"path":           t.TempDir(),
+		"sweep_interval": "20ms",
+		"sweep_batch":    2,
+	})
+	defer inst.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := inst.Set(fmt.Sprintf("tmp:%d", i), i, 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := inst.Set("tmp:keep", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	sweeper := inst.(interface{ Reclaimed() int64 })
+	deadline := time.Now().Add(time.Second)
+	for sweeper.Reclaimed() < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := sweeper.Reclaimed(); n != 5 {
+		t.Fatalf("unexpected reclaimed count: %d", n)
+	}
+	if found, _ := inst.HasPrefix("tmp:"); len(found) != 1 {
+		t.Fatalf("unexpected keys after sweep: %v", found)
+	}
+}
+
+func TestLevelDBQuota(t *testing.T) {
+	for _, tc := range []struct {
+		eviction string
+		evicted  string
+	}{
+		{"oldest", "a"},
+		{"lru", "b"},
+	} {
+		t.Run(tc.eviction, func(t *testing.T) {
+			inst := newLevelDBCache(t, map[string]interface{}{
+				"path":        t.TempDir(),
+				"max_entries": 3,
+				"eviction":    tc.eviction,
+			})
+			defer inst.Close()
+
+			for _, key := range []string{"a", "b", "c"} {
+				if err := inst.Set(key, key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_ = inst.GetString("a")
+			if err := inst.Set("d", "d"); err != nil {
+				t.Fatal(err)
+			}
+			if inst.Has(tc.evicted) {
+				t.Fatalf("%s not evicted", tc.evicted)
+			}
+			if n, _ := inst.(interface{ Usage() (int, int64) }).Usage(); n != 3 {
+				t.Fatalf("unexpected entries: %d", n)
+			}
+		})
+	}
+
+	inst := newLevelDBCache(t, map[string]interface{}{
+		"path":      t.TempDir(),
+		"max_bytes": 1024,
+	})
+	defer inst.Close()
+	for i := 0; i < 100; i++ {
+		if err := inst.Set(fmt.Sprintf("key:%d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, bytes := inst.(interface{ Usage() (int, int64) }).Usage()
+	if bytes > 1024 || n == 0 || !inst.Has("key:99") {
+		t.Fatalf("unexpected usage: %d entries, %d bytes", n, bytes)
+	}
+	if found, _ := inst.HasPrefix("key:"); len(found) != n {
+		t.Fatalf("index out of sync: %d keys on disk, %d indexed", len(found), n)
+	}
+
+	// 未设置配额时不维护索引，Usage 遍历数据库统计
+	inst = newLevelDBCache(t, map[string]interface{}{"path": t.TempDir()})
+	defer inst.Close()
+	_ = inst.Set("a", 1)
+	_ = inst.Set("b", 2)
+	_ = inst.Del("a")
+	if n, _ := inst.(interface{ Usage() (int, int64) }).Usage(); n != 1 {
+		t.Fatalf("unexpected entries without quota: %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package test
+
+import (
+	"fmt"
+	"github.com/iamdanielyin/cache"
+	_ "github.com/iamdanielyin/cache/driver/memory"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newMemoryCache(tb testing.TB, options map[string]interface{}) cache.Cache {
+	inst, err := cache.NewCache(&cache.Config{Driver: "memory", Options: options})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = inst.Close() })
+	return inst
+}
+
+func TestMemoryCache(t *testing.T) {
+	inst := newMemoryCache(t, nil)
+
+	if err := inst.Set("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if v := inst.GetString("foo"); v != "bar" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+	if err := inst.Set("tmp", 1, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if inst.Has("tmp") {
+		t.Fatal("expired key still present")
+	}
+	if v, _ := inst.IncrBy("n", 5); v != 5 {
+		t.Fatalf("unexpected counter: %d", v)
+	}
+	if v, _ := inst.Incr("n"); v != 6 || inst.GetInt("n") != 6 {
+		t.Fatalf("unexpected counter: %d", v)
+	}
+	if m, _ := inst.HasPrefix("fo"); len(m) != 1 {
+		t.Fatalf("unexpected prefix result: %v", m)
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	inst := newMemoryCache(t, map[string]interface{}{"max_entries": 3})
+
+	for i := 0; i < 3; i++ {
+		_ = inst.Set(fmt.Sprintf("k%d", i), i)
+	}
+	// 访问 k0 使其成为最近使用
+	_ = inst.GetInt("k0")
+	_ = inst.Set("k3", 3)
+	if !inst.Has("k0") || inst.Has("k1") || !inst.Has("k3") {
+		t.Fatal("unexpected LRU eviction")
+	}
+
+	inst = newMemoryCache(t, map[string]interface{}{"max_bytes": 64})
+	for i := 0; i < 10; i++ {
+		_ = inst.Set(fmt.Sprintf("key%d", i), "0123456789")
+	}
+	_, bytes := inst.(interface{ Usage() (int, int64) }).Usage()
+	if bytes > 64 {
+		t.Fatalf("usage exceeds max_bytes: %d", bytes)
+	}
+	if !inst.Has("key9") || inst.Has("key0") {
+		t.Fatal("unexpected size-based eviction")
+	}
+}
+
+// 指定的分片数大于容量时总数仍不超过 max_entries 及 max_bytes
+func TestMemoryCacheShardLimit(t *testing.T) {
+	inst := newMemoryCache(t, map[string]interface{}{"max_entries": 3, "shards": 64})
+	for i := 0; i < 100; i++ {
+		_ = inst.Set(fmt.Sprintf("k%d", i), i)
+	}
+	if n, _ := inst.(interface{ Usage() (int, int64) }).Usage(); n > 3 {
+		t.Fatalf("entries = %d, exceeds max_entries 3", n)
+	}
+
+	inst = newMemoryCache(t, map[string]interface{}{"max_bytes": 100, "shards": 64})
+	for i := 0; i < 100; i++ {
+		_ = inst.Set(fmt.Sprintf("k%d", i), "0123456789")
+	}
+	if _, bytes := inst.(interface{ Usage() (int, int64) }).Usage(); bytes > 100 {
+		t.Fatalf("usage = %d, exceeds max_bytes 100", bytes)
+	}
+}
+
+// zipfHitRatio 按 Zipf 分布访问 key，未命中时写入，并周期性插入一次性扫描的 key
+func zipfHitRatio(tb testing.TB, policy string, ops int, scan bool) float64 {
+	inst := newMemoryCache(tb, map[string]interface{}{
+		"max_entries": 1000,
+		"policy":      policy,
+	})
+	var (
+		r          = rand.New(rand.NewSource(1))
+		zipf       = rand.NewZipf(r, 1.01, 1, 100000)
+		hits, reqs int
+	)
+	for i := 0; i < ops; i++ {
+		if scan && i%10000 == 0 {
+			for j := 0; j < 2000; j++ {
+				key := fmt.Sprintf("scan:%d:%d", i, j)
+				if !inst.Has(key) {
+					_ = inst.Set(key, j)
+				}
+			}
+		}
+		key := strconv.FormatUint(zipf.Uint64(), 10)
+		reqs++
+		if inst.Has(key) {
+			hits++
+		} else {
+			_ = inst.Set(key, i)
+		}
+	}
+	return float64(hits) / float64(reqs)
+}
+
+func TestMemoryCacheTinyLFU(t *testing.T) {
+	for _, scan := range []bool{false, true} {
+		lru := zipfHitRatio(t, "lru", 200000, scan)
+		lfu := zipfHitRatio(t, "tinylfu", 200000, scan)
+		t.Logf("scan=%v lru=%.4f tinylfu=%.4f", scan, lru, lfu)
+		if lfu <= lru {
+			t.Fatalf("tinylfu hit ratio %.4f not better than lru %.4f", lfu, lru)
+		}
+	}
+}
+
+func BenchmarkMemoryCacheHitRatio(b *testing.B) {
+	for _, policy := range []string{"lru", "tinylfu"} {
+		for _, scan := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/scan=%v", policy, scan), func(b *testing.B) {
+				ratio := zipfHitRatio(b, policy, b.N, scan)
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
+
+// BenchmarkMemoryCacheParallel 对比单分片与多分片在并发读写下的吞吐量，
+// 使用 -cpu 1,2,4,8 观察吞吐量随 GOMAXPROCS 的变化
+func BenchmarkMemoryCacheParallel(b *testing.B) {
+	for _, shards := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			inst := newMemoryCache(b, map[string]interface{}{
+				"max_entries": 100000,
+				"shards":      shards,
+			})
+			keys := make([]string, 1<<14)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+				_ = inst.Set(keys[i], i)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Int()
+				for pb.Next() {
+					key := keys[i&(len(keys)-1)]
+					if i%10 == 0 {
+						_ = inst.Set(key, i)
+					} else {
+						_ = inst.GetInt(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
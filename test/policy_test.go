@@ -0,0 +1,184 @@
+package test
+
+import (
+	"fmt"
+	"github.com/iamdanielyin/cache"
+	"testing"
+	"time"
+)
+
+// newPolicyChain 创建 memory -> fake_remote 两级缓存，store 为远程层级共享的数据
+func newPolicyChain(t *testing.T, local, remote cache.Policy, store cache.Cache) cache.Cache {
+	inst, err := cache.NewMultiLevelCache([]cache.Config{
+		{Driver: "memory", Policy: local},
+		{
+			Driver:  "fake_remote",
+			Options: map[string]interface{}{"store": store, "broker": &broker{}, "node_id": "a"},
+			Policy:  remote,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inst
+}
+
+func localEntries(c cache.Cache) int {
+	n, _ := c.(interface{ Usage() (int, int64) }).Usage()
+	return n
+}
+
+func TestPolicy(t *testing.T) {
+	t.Run("write-around", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		inst := newPolicyChain(t, cache.Policy{WriteAround: true}, cache.Policy{}, store)
+		defer inst.Close()
+
+		if err := inst.Set("k", 1); err != nil {
+			t.Fatal(err)
+		}
+		if n := localEntries(inst); n != 0 {
+			t.Fatalf("local entries after Set = %d, want 0", n)
+		}
+		if v := store.GetInt("k"); v != 1 {
+			t.Fatalf("remote k = %d, want 1", v)
+		}
+		if v := inst.GetInt("k"); v != 1 {
+			t.Fatalf("k = %d, want 1", v)
+		}
+		if n := localEntries(inst); n != 1 {
+			t.Fatalf("local entries after Get = %d, want 1", n)
+		}
+	})
+
+	t.Run("no-populate", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		_ = store.Set("k", 1)
+		inst := newPolicyChain(t, cache.Policy{NoPopulate: true}, cache.Policy{}, store)
+		defer inst.Close()
+
+		if v := inst.GetInt("k"); v != 1 {
+			t.Fatalf("k = %d, want 1", v)
+		}
+		if n := localEntries(inst); n != 0 {
+			t.Fatalf("local entries after Get = %d, want 0", n)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		_ = store.Set("shared", 1)
+		inst := newPolicyChain(t, cache.Policy{}, cache.Policy{ReadOnly: true}, store)
+		defer inst.Close()
+
+		if v := inst.GetInt("shared"); v != 1 {
+			t.Fatalf("shared = %d, want 1", v)
+		}
+		if err := inst.Set("k", 2); err != nil {
+			t.Fatal(err)
+		}
+		if store.Has("k") {
+			t.Fatal("read-only level was written")
+		}
+		if err := inst.Del("shared"); err != nil {
+			t.Fatal(err)
+		}
+		if !store.Has("shared") {
+			t.Fatal("read-only level was deleted")
+		}
+		if _, err := inst.Incr("n"); err != cache.ErrReadOnly {
+			t.Fatalf("Incr err = %v, want ErrReadOnly", err)
+		}
+	})
+
+	t.Run("max-ttl", func(t *testing.T) {
+		store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+		_ = store.Set("remote", 1)
+		inst := newPolicyChain(t, cache.Policy{MaxTTL: time.Minute}, cache.Policy{}, store)
+		defer inst.Close()
+
+		_ = inst.Set("k", 1, time.Hour)
+		_ = inst.GetInt("remote")
+		for _, key := range []string{"k", "remote"} {
+			if ttl, ok := inst.TTL(key); !ok || ttl <= 0 || ttl > time.Minute {
+				t.Fatalf("%s ttl = %v, want (0, 1m]", key, ttl)
+			}
+		}
+		if ttl, _ := store.TTL("k"); ttl <= time.Minute {
+			t.Fatalf("remote ttl = %v, want uncapped", ttl)
+		}
+	})
+}
+
+func TestPolicyTTLScaling(t *testing.T) {
+	store, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+	_ = store.Set("remote", 1, time.Hour)
+	local := cache.Policy{TTLFraction: 0.1, MaxTTL: 5 * time.Minute, Jitter: &cache.Jitter{Range: time.Minute}}
+	inst := newPolicyChain(t, local, cache.Policy{}, store)
+	defer inst.Close()
+
+	_ = inst.Set("short", 1, 10*time.Minute)
+	_ = inst.Set("long", 1, time.Hour)
+	_ = inst.GetInt("remote")
+	cases := map[string][2]time.Duration{
+		// 10m * 0.1 = 1m，最多随机减少 30s
+		"short": {30 * time.Second, time.Minute},
+		// 1h * 0.1 = 6m，限制为 5m 后最多随机减少 1m
+		"long":   {4 * time.Minute, 5 * time.Minute},
+		"remote": {4 * time.Minute, 5 * time.Minute},
+	}
+	for key, want := range cases {
+		ttl, ok := inst.TTL(key)
+		if !ok || ttl < want[0]-time.Second || ttl > want[1] {
+			t.Fatalf("%s ttl = %v, want [%v, %v]", key, ttl, want[0], want[1])
+		}
+	}
+	if ttl, _ := store.TTL("long"); ttl <= 50*time.Minute {
+		t.Fatalf("remote ttl = %v, want unscaled", ttl)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	// 相同的种子得到相同的结果
+	a := &cache.Jitter{Percent: 0.2, Seed: 42}
+	b := &cache.Jitter{Percent: 0.2, Seed: 42}
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		x, y := a.Apply(time.Hour), b.Apply(time.Hour)
+		if x != y {
+			t.Fatalf("seeded jitter differs: %v != %v", x, y)
+		}
+		if x <= 48*time.Minute || x > time.Hour {
+			t.Fatalf("jittered ttl = %v, want (48m, 1h]", x)
+		}
+		seen[x] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("jitter produced a constant ttl")
+	}
+
+	// 同一批写入的 key 过期时间分散
+	inst, err := cache.NewCache(&cache.Config{
+		Driver: "memory",
+		Policy: cache.Policy{Jitter: &cache.Jitter{Range: time.Minute, Seed: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst.Close()
+	values := make(map[string]interface{})
+	for i := 0; i < 20; i++ {
+		values[fmt.Sprintf("k%d", i)] = i
+	}
+	if err := inst.MSet(values, 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	ttls := make(map[time.Duration]bool)
+	for key := range values {
+		ttl, _ := inst.TTL(key)
+		ttls[ttl.Truncate(time.Second)] = true
+	}
+	if len(ttls) < 2 {
+		t.Fatal("batch written with identical expiration")
+	}
+}
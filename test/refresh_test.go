@@ -0,0 +1,87 @@
+package test
+
+import (
+	"context"
+	"github.com/iamdanielyin/cache"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	caches := map[string]cache.Cache{
+		"memory": func() cache.Cache {
+			inst, _ := cache.NewCache(&cache.Config{Driver: "memory"})
+			return inst
+		}(),
+		"ldb": newLevelDBCache(t, map[string]interface{}{"path": t.TempDir()}),
+	}
+	for name, inst := range caches {
+		t.Run(name, func(t *testing.T) {
+			defer inst.Close()
+
+			var calls int32
+			release := make(chan struct{})
+			cache.RegisterRefresh(inst, "user:", func(ctx context.Context, key string) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "new", nil
+			}, &cache.SetOptions{Expiration: time.Hour, SoftTTL: time.Minute})
+			defer cache.UnregisterRefresh(inst, "user:")
+
+			if err := inst.SetWithOptions("user:1", "old", cache.SetOptions{Expiration: time.Hour, SoftTTL: 20 * time.Millisecond}); err != nil {
+				t.Fatal(err)
+			}
+			if meta, ok := inst.HasGetMeta("user:1", new(string)); !ok || meta.Stale() {
+				t.Fatalf("fresh entry reported stale: %+v", meta)
+			}
+			time.Sleep(30 * time.Millisecond)
+
+			// 过期前返回旧值，并发读取只触发一次刷新
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if v := inst.GetString("user:1"); v != "old" {
+						t.Errorf("stale read = %q, want old", v)
+					}
+				}()
+			}
+			wg.Wait()
+			close(release)
+
+			waitString(t, inst, "user:1", "new")
+			if n := atomic.LoadInt32(&calls); n != 1 {
+				t.Fatalf("refresh called %d times, want 1", n)
+			}
+			meta, ok := inst.HasGetMeta("user:1", new(string))
+			if !ok || meta.SoftDuration != time.Minute {
+				t.Fatalf("refreshed meta = %+v", meta)
+			}
+
+			// 批量读取同样在后台刷新
+			_ = inst.SetWithOptions("user:3", "old", cache.SetOptions{Expiration: time.Hour, SoftTTL: 20 * time.Millisecond})
+			time.Sleep(30 * time.Millisecond)
+			dst := map[string]interface{}{"user:3": new(string)}
+			if _, err := inst.MGet(dst); err != nil || *dst["user:3"].(*string) != "old" {
+				t.Fatalf("stale MGet = %q, %v, want old", *dst["user:3"].(*string), err)
+			}
+			deadline := time.Now().Add(time.Second)
+			for atomic.LoadInt32(&calls) != 2 {
+				if time.Now().After(deadline) {
+					t.Fatal("MGet did not refresh the stale value")
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			waitString(t, inst, "user:3", "new")
+
+			// Set 只使用第一个过期时间参数
+			_ = inst.Set("user:2", "v", time.Hour, time.Millisecond)
+			if meta, ok := inst.HasGetMeta("user:2", new(string)); !ok || meta.SoftDuration != 0 {
+				t.Fatalf("Set recorded a soft ttl: %+v", meta)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/iamdanielyin/cache"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	cache.RegisterDriver(&recordingDriver{})
+}
+
+var errRecording = errors.New("recording: rejected")
+
+// recordingDriver 模拟远程层级，记录收到的写入，gate 未关闭前写入会阻塞
+type recordingDriver struct{}
+
+func (d *recordingDriver) Name() string {
+	return "recording"
+}
+
+func (d *recordingDriver) NewCache(m map[string]interface{}) (cache.Cache, error) {
+	return &recordingCache{
+		Cache: m["store"].(cache.Cache),
+		rec:   m["recorder"].(*recorder),
+	}, nil
+}
+
+type recorder struct {
+	mu     sync.Mutex
+	writes []string
+	gate   chan struct{}
+	reject string
+}
+
+func (r *recorder) record(key string) error {
+	<-r.gate
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writes = append(r.writes, key)
+	if key == r.reject {
+		return errRecording
+	}
+	return nil
+}
+
+func (r *recorder) count(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for _, k := range r.writes {
+		if k == key {
+			n++
+		}
+	}
+	return n
+}
+
+type recordingCache struct {
+	cache.Cache
+	rec      *recorder
+	previous cache.Cache
+}
+
+func (c *recordingCache) SetCtx(ctx context.Context, key string, value interface{}, expiration ...time.Duration) error {
+	if err := c.rec.record(key); err != nil {
+		return err
+	}
+	return c.Cache.SetCtx(ctx, key, value, expiration...)
+}
+
+func (c *recordingCache) SetWithOptionsCtx(ctx context.Context, key string, value interface{}, opts cache.SetOptions) error {
+	if err := c.rec.record(key); err != nil {
+		return err
+	}
+	return c.Cache.SetWithOptionsCtx(ctx, key, value, opts)
+}
+
+func (c *recordingCache) MDelCtx(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := c.rec.record(key); err != nil {
+			return err
+		}
+	}
+	return c.Cache.MDelCtx(ctx, keys...)
+}
+
+func (c *recordingCache) Next() cache.Cache {
+	return nil
+}
+
+func (c *recordingCache) Previous() cache.Cache {
+	return c.previous
+}
+
+func (c *recordingCache) SetPrevious(previous cache.Cache) {
+	c.previous = previous
+}
+
+func (c *recordingCache) Close() error {
+	return nil
+}
+
+func (c *recordingCache) RemoteSupport() bool {
+	return true
+}
+
+func TestWriteBack(t *testing.T) {
+	store, err := cache.NewCache(&cache.Config{Driver: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{gate: make(chan struct{}), reject: "bad"}
+	var (
+		mu     sync.Mutex
+		failed []string
+	)
+	inst, err := cache.NewMultiLevelCache([]cache.Config{
+		{
+			Driver: "memory",
+			Options: map[string]interface{}{
+				"write_back": true,
+				"write_back_on_error": func(key string, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					failed = append(failed, key)
+				},
+			},
+		},
+		{
+			Driver:  "recording",
+			Options: map[string]interface{}{"store": store, "recorder": rec},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 下一级阻塞时写入仍立即返回
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = inst.Set("a", 1)
+		for i := 1; i <= 3; i++ {
+			_ = inst.Set("b", i)
+		}
+		_ = inst.Set("bad", 1)
+		_ = inst.Del("c")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write-back Set blocked on the next level")
+	}
+	if v := inst.GetInt("b"); v != 3 {
+		t.Fatalf("local b = %d, want 3", v)
+	}
+
+	close(rec.gate)
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 关闭时提交全部写入，b 的多次写入合并为一次
+	if n := rec.count("b"); n != 1 {
+		t.Fatalf("b written %d times, want 1", n)
+	}
+	if n := rec.count("c"); n != 1 {
+		t.Fatalf("c deleted %d times, want 1", n)
+	}
+	if v := store.GetInt("a"); v != 1 {
+		t.Fatalf("next a = %d, want 1", v)
+	}
+	if v := store.GetInt("b"); v != 3 {
+		t.Fatalf("next b = %d, want 3", v)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 || failed[0] != "bad" {
+		t.Fatalf("failed = %v, want [bad]", failed)
+	}
+}
+
+// 队列已满或等待提交时，ctx 结束即返回
+func TestWriteBackContext(t *testing.T) {
+	store, err := cache.NewCache(&cache.Config{Driver: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{gate: make(chan struct{})}
+	inst, err := cache.NewMultiLevelCache([]cache.Config{
+		{Driver: "memory", Options: map[string]interface{}{"write_back": true, "write_back_queue": 1}},
+		{Driver: "recording", Options: map[string]interface{}{"store": store, "recorder": rec}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = inst.Set("a", 1)
+	_ = inst.Set("b", 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := inst.SetCtx(ctx, "c", 3); err != context.DeadlineExceeded {
+		t.Fatalf("SetCtx on a full queue = %v, want DeadlineExceeded", err)
+	}
+	if err := inst.DelPrefixCtx(ctx, "x"); err != context.DeadlineExceeded {
+		t.Fatalf("DelPrefixCtx while flushing = %v, want DeadlineExceeded", err)
+	}
+
+	close(rec.gate)
+	if err := inst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v := store.GetInt("b"); v != 2 {
+		t.Fatalf("next b = %d, want 2", v)
+	}
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Typed 基于任意 Cache 提供类型安全的读写
+type Typed[T any] struct {
+	cache Cache
+}
+
+func NewTyped[T any](c Cache) *Typed[T] {
+	return &Typed[T]{cache: c}
+}
+
+func (t *Typed[T]) Cache() Cache {
+	return t.cache
+}
+
+func (t *Typed[T]) Has(key string) bool {
+	return t.HasCtx(context.Background(), key)
+}
+
+func (t *Typed[T]) HasCtx(ctx context.Context, key string) bool {
+	return t.cache.HasCtx(ctx, key)
+}
+
+func (t *Typed[T]) Get(key string) (T, bool) {
+	return t.GetCtx(context.Background(), key)
+}
+
+func (t *Typed[T]) GetCtx(ctx context.Context, key string) (T, bool) {
+	var v T
+	if !t.cache.HasGetCtx(ctx, key, &v) {
+		var zero T
+		return zero, false
+	}
+	return v, true
+}
+
+func (t *Typed[T]) GetOrDefault(key string, defaultValue T) T {
+	return t.GetOrDefaultCtx(context.Background(), key, defaultValue)
+}
+
+func (t *Typed[T]) GetOrDefaultCtx(ctx context.Context, key string, defaultValue T) T {
+	if v, has := t.GetCtx(ctx, key); has {
+		return v
+	}
+	return defaultValue
+}
+
+func (t *Typed[T]) Set(key string, value T, expiration ...time.Duration) error {
+	return t.SetCtx(context.Background(), key, value, expiration...)
+}
+
+func (t *Typed[T]) SetCtx(ctx context.Context, key string, value T, expiration ...time.Duration) error {
+	return t.cache.SetCtx(ctx, key, value, expiration...)
+}
+
+func (t *Typed[T]) MGet(keys ...string) (map[string]T, error) {
+	return t.MGetCtx(context.Background(), keys...)
+}
+
+func (t *Typed[T]) MGetCtx(ctx context.Context, keys ...string) (map[string]T, error) {
+	dst := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		dst[key] = new(T)
+	}
+	found, err := t.cache.MGetCtx(ctx, dst)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]T, len(found))
+	for key := range found {
+		values[key] = *dst[key].(*T)
+	}
+	return values, nil
+}
+
+func (t *Typed[T]) MSet(values map[string]T, expiration ...time.Duration) error {
+	return t.MSetCtx(context.Background(), values, expiration...)
+}
+
+func (t *Typed[T]) MSetCtx(ctx context.Context, values map[string]T, expiration ...time.Duration) error {
+	m := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		m[key] = value
+	}
+	return t.cache.MSetCtx(ctx, m, expiration...)
+}
+
+func (t *Typed[T]) Del(keys ...string) error {
+	return t.DelCtx(context.Background(), keys...)
+}
+
+func (t *Typed[T]) DelCtx(ctx context.Context, keys ...string) error {
+	return t.cache.DelCtx(ctx, keys...)
+}
@@ -0,0 +1,280 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrWriteBackClosed = errors.New(`cache: write-back queue closed`)
+
+const defaultWriteBackQueue = 1024
+
+// WriteBackOptions 异步写入下一级的配置
+type WriteBackOptions struct {
+	// QueueSize 等待写入的 key 数量上限，队列已满时写入会阻塞，默认 1024
+	QueueSize int
+	// OnError 写入下一级失败时回调
+	OnError func(key string, err error)
+	// Codec 加入队列时使用的编码方式，默认使用 JSON，下一级按该编码方式保存
+	Codec Codec
+}
+
+// ParseWriteBackOptions 未开启 write_back 时返回 nil
+func ParseWriteBackOptions(m map[string]interface{}) *WriteBackOptions {
+	if !BoolOption(m, "write_back") {
+		return nil
+	}
+	opts := &WriteBackOptions{QueueSize: IntOption(m, "write_back_queue")}
+	opts.OnError, _ = m["write_back_on_error"].(func(string, error))
+	// 与本级使用相同的编码方式，codec 无效时由驱动返回错误
+	opts.Codec, _ = ParseCodec(m)
+	return opts
+}
+
+type writeOp struct {
+	key      string
+	del      bool
+	value    *Encoded
+	deadline time.Time
+	// 软过期时间点
+	stale time.Time
+	delta time.Duration
+}
+
+// WriteBack 本级写入后立即返回，由后台协程按先后顺序把写入提交给下一级；
+// 同一 key 在提交前的多次写入只保留最后一次
+type WriteBack struct {
+	next    func() Cache
+	opts    WriteBackOptions
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending map[string]*writeOp
+	queue   []string
+	// 正在提交的写入
+	current *writeOp
+	closed  bool
+	done    chan struct{}
+}
+
+func NewWriteBack(next func() Cache, opts WriteBackOptions) *WriteBack {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultWriteBackQueue
+	}
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+	w := &WriteBack{
+		next:    next,
+		opts:    opts,
+		pending: make(map[string]*writeOp),
+		done:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// Set 值在加入队列时编码，调用方之后修改 value 不会影响提交的内容
+func (w *WriteBack) Set(ctx context.Context, key string, value interface{}, opts SetOptions) error {
+	codec, data, err := Encode(w.opts.Codec, value)
+	if err != nil {
+		return err
+	}
+	op := &writeOp{key: key, value: &Encoded{Codec: codec, Data: data}, delta: opts.Delta}
+	if opts.Expiration > 0 {
+		op.deadline = time.Now().Add(opts.Expiration)
+	}
+	if opts.SoftTTL > 0 {
+		op.stale = time.Now().Add(opts.SoftTTL)
+	}
+	return w.enqueue(ctx, op)
+}
+
+func (w *WriteBack) MSet(ctx context.Context, values map[string]interface{}, expiration ...time.Duration) error {
+	var opts SetOptions
+	if len(expiration) > 0 {
+		opts.Expiration = expiration[0]
+	}
+	for key, value := range values {
+		if err := w.Set(ctx, key, value, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WriteBack) Del(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := w.enqueue(ctx, &writeOp{key: key, del: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WriteBack) enqueue(ctx context.Context, op *writeOp) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriteBackClosed
+	}
+	// 合并到尚未提交的写入，保持原有的队列位置
+	if p, ok := w.pending[op.key]; ok {
+		*p = *op
+		return nil
+	}
+	if len(w.queue) >= w.opts.QueueSize {
+		defer w.wakeOnDone(ctx)()
+		for len(w.queue) >= w.opts.QueueSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			w.cond.Wait()
+		}
+	}
+	w.pending[op.key] = op
+	w.queue = append(w.queue, op.key)
+	w.cond.Broadcast()
+	return nil
+}
+
+// FlushKey 同步提交 key 尚未提交的写入，原子操作及条件写入前需要调用
+func (w *WriteBack) FlushKey(ctx context.Context, key string) error {
+	w.mu.Lock()
+	if w.current != nil && w.current.key == key {
+		stop := w.wakeOnDone(ctx)
+		for w.current != nil && w.current.key == key {
+			if err := ctx.Err(); err != nil {
+				stop()
+				w.mu.Unlock()
+				return err
+			}
+			w.cond.Wait()
+		}
+		stop()
+	}
+	op, ok := w.pending[key]
+	if ok {
+		delete(w.pending, key)
+		for i, k := range w.queue {
+			if k == key {
+				w.queue = append(w.queue[:i], w.queue[i+1:]...)
+				break
+			}
+		}
+		w.cond.Broadcast()
+	}
+	w.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return w.apply(ctx, op)
+}
+
+// Flush 等待队列中的写入全部提交，ctx 结束时返回 ctx.Err()
+func (w *WriteBack) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.queue) > 0 || w.current != nil {
+		defer w.wakeOnDone(ctx)()
+	}
+	for len(w.queue) > 0 || w.current != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// wakeOnDone 在 ctx 结束时唤醒所有等待 cond 的调用方，使其检查 ctx.Err()；返回的函数用于停止等待
+func (w *WriteBack) wakeOnDone(ctx context.Context) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			w.cond.Broadcast()
+			w.mu.Unlock()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// Close 提交队列中剩余的写入后停止后台协程
+func (w *WriteBack) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *WriteBack) run() {
+	defer close(w.done)
+
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		key := w.queue[0]
+		w.queue = w.queue[1:]
+		op := w.pending[key]
+		delete(w.pending, key)
+		w.current = op
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		_ = w.apply(context.Background(), op)
+
+		w.mu.Lock()
+		w.current = nil
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+func (w *WriteBack) apply(ctx context.Context, op *writeOp) error {
+	next := w.next()
+	if next == nil {
+		return nil
+	}
+	// 过期时间从本级写入时开始计算
+	var (
+		err  error
+		ttl  time.Duration
+		soft time.Duration
+	)
+	if !op.deadline.IsZero() {
+		ttl = time.Until(op.deadline)
+	}
+	if !op.stale.IsZero() {
+		// 已超过软过期时间时仍需保留标记
+		if soft = time.Until(op.stale); soft <= 0 {
+			soft = time.Nanosecond
+		}
+	}
+	if op.del || (!op.deadline.IsZero() && ttl <= 0) {
+		err = next.MDelCtx(ctx, op.key)
+	} else {
+		err = next.SetWithOptionsCtx(ctx, op.key, op.value, SetOptions{Expiration: ttl, SoftTTL: soft, Delta: op.delta})
+	}
+	if err != nil && w.opts.OnError != nil {
+		w.opts.OnError(op.key, err)
+	}
+	return err
+}